@@ -0,0 +1,508 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"github.com/go-zoox/headers"
+)
+
+// AWS Signature Version 4 constants
+const (
+	AWSSigV4Algorithm        = "AWS4-HMAC-SHA256"
+	AWSSigV4UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	AWSSigV4StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+)
+
+const (
+	awsSigV4TimeFormat  = "20060102T150405Z"
+	awsSigV4DateFormat  = "20060102"
+	awsSigV4EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// awsSigV4IgnoredHeaders are not signed
+var awsSigV4IgnoredHeaders = map[string]bool{
+	"authorization":     true,
+	"user-agent":        true,
+	"x-amzn-trace-id":   true,
+	"expect":            true,
+	"connection":        true,
+	"content-length":    true,
+	"transfer-encoding": true,
+}
+
+// AWSSigV4Config is the config of AWS Signature Version 4 signer
+type AWSSigV4Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is the session token of temporary credentials
+	SessionToken string
+	//
+	Region  string
+	Service string
+
+	// UnsignedPayload skips hashing the payload, only for S3 over https
+	UnsignedPayload bool
+	// StreamingChunkSize enables streaming chunked signing (aws-chunked) for large uploads,
+	//	the payload is signed chunk by chunk without buffering, for example 64 * 1024
+	StreamingChunkSize int
+
+	// Now returns the signing time, default time.Now
+	Now func() time.Time `json:"-"`
+}
+
+// AWSSigV4Signer signs the request by AWS Signature Version 4
+type AWSSigV4Signer struct {
+	clockSkews
+	config *AWSSigV4Config
+}
+
+// NewAWSSigV4Signer creates an AWS Signature Version 4 signer
+func NewAWSSigV4Signer(cfg *AWSSigV4Config) *AWSSigV4Signer {
+	return &AWSSigV4Signer{
+		config: cfg,
+	}
+}
+
+// SetAWSSigV4 signs the requests by AWS Signature Version 4
+func (f *Fetch) SetAWSSigV4(cfg *AWSSigV4Config) *Fetch {
+	f.config.AWSSigV4 = NewAWSSigV4Signer(cfg)
+	return f
+}
+
+// Presign returns the presigned url of the request, which is valid for expires,
+//
+//	the url can be used without credentials, like downloading an object from browser.
+func (f *Fetch) Presign(expires time.Duration) (string, error) {
+	if f.config.AWSSigV4 == nil {
+		return "", fmt.Errorf("aws sigv4 is not configured")
+	}
+
+	config, err := f.Config()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	if err := addConfigQuery(query, config); err != nil {
+		return "", err
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(config.Method, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return config.AWSSigV4.Presign(req, expires)
+}
+
+func (s *AWSSigV4Signer) now(req *http.Request) time.Time {
+	if s.config.Now != nil {
+		return s.config.Now().UTC()
+	}
+
+	return s.clockSkews.now(req.URL.Host)
+}
+
+func (s *AWSSigV4Signer) scope(t time.Time) string {
+	return strings.Join([]string{t.Format(awsSigV4DateFormat), s.config.Region, s.config.Service, "aws4_request"}, "/")
+}
+
+func (s *AWSSigV4Signer) signingKey(t time.Time) []byte {
+	key := awsHMAC([]byte("AWS4"+s.config.SecretAccessKey), t.Format(awsSigV4DateFormat))
+	key = awsHMAC(key, s.config.Region)
+	key = awsHMAC(key, s.config.Service)
+	return awsHMAC(key, "aws4_request")
+}
+
+// Sign implements Signer, the body is read by GetBody to hash the payload
+func (s *AWSSigV4Signer) Sign(req *http.Request) error {
+	t := s.now(req)
+	amzDate := t.Format(awsSigV4TimeFormat)
+
+	req.Header.Del(headers.Authorization)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	streaming := s.config.StreamingChunkSize > 0 && hasBody
+
+	var payloadHash string
+	switch {
+	case streaming:
+		if req.ContentLength <= 0 {
+			length, err := bodyLength(req)
+			if err != nil {
+				return err
+			}
+
+			req.ContentLength = length
+		}
+
+		payloadHash = AWSSigV4StreamingPayload
+		req.Header.Set(headers.ContentEncoding, appendContentEncoding(req.Header.Get(headers.ContentEncoding), "aws-chunked"))
+		req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(req.ContentLength, 10))
+		req.ContentLength = awsChunkedLength(req.ContentLength, int64(s.config.StreamingChunkSize))
+	case s.config.UnsignedPayload:
+		payloadHash = AWSSigV4UnsignedPayload
+	case !hasBody:
+		payloadHash = awsSigV4EmptySHA256
+	default:
+		if err := makeBodyReplayable(req); err != nil {
+			return err
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		length, err := io.Copy(hash, body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+
+		payloadHash = hex.EncodeToString(hash.Sum(nil))
+		if req.ContentLength <= 0 {
+			req.ContentLength = length
+		}
+	}
+
+	// S3 requires the payload hash header, and the special payloads must be declared
+	if s.config.Service == "s3" || payloadHash == AWSSigV4UnsignedPayload || payloadHash == AWSSigV4StreamingPayload {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	signature := s.signature(t, canonicalRequest)
+	req.Header.Set(headers.Authorization, fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		AWSSigV4Algorithm, s.config.AccessKeyID, s.scope(t), signedHeaders, signature,
+	))
+
+	if streaming {
+		body := req.Body
+		req.Body = newAWSChunkedReader(body, s, t, signature)
+		if req.GetBody != nil {
+			getBody := req.GetBody
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+
+				return newAWSChunkedReader(body, s, t, signature), nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// Presign returns the presigned url of the request, the payload is unsigned
+func (s *AWSSigV4Signer) Presign(req *http.Request, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", fmt.Errorf("invalid presign expires: %s, must be between 1s and 7 days", expires)
+	}
+
+	t := s.now(req)
+
+	u := *req.URL
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", AWSSigV4Algorithm)
+	query.Set("X-Amz-Credential", s.config.AccessKeyID+"/"+s.scope(t))
+	query.Set("X-Amz-Date", t.Format(awsSigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	if s.config.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(req)
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(&u),
+		awsCanonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		AWSSigV4UnsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(t, canonicalRequest))
+	u.RawQuery = awsCanonicalQuery(query)
+
+	return u.String(), nil
+}
+
+func (s *AWSSigV4Signer) signature(t time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		AWSSigV4Algorithm,
+		t.Format(awsSigV4TimeFormat),
+		s.scope(t),
+		awsSHA256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	return hex.EncodeToString(awsHMAC(s.signingKey(t), stringToSign))
+}
+
+// canonicalURI returns the canonical path,
+//
+//	S3 encodes the path once, other services encode the escaped path again.
+func (s *AWSSigV4Signer) canonicalURI(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+
+	uri := awsEscape(path, false)
+	if s.config.Service != "s3" {
+		uri = awsEscape(uri, false)
+	}
+
+	return uri
+}
+
+// canonicalHeaders returns the signed headers and the canonical headers,
+//
+//	all headers are signed except the ones may be changed by the transport or proxies,
+//	content-length is signed by the request content length.
+func (s *AWSSigV4Signer) canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	values := map[string]string{"host": host}
+	if req.ContentLength > 0 {
+		values["content-length"] = strconv.FormatInt(req.ContentLength, 10)
+	}
+	for k, v := range req.Header {
+		key := strings.ToLower(k)
+		if awsSigV4IgnoredHeaders[key] {
+			continue
+		}
+
+		trimmed := make([]string, len(v))
+		for i, value := range v {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		values[key] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	return strings.Join(names, ";"), canonical.String()
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape escapes the string by RFC 3986, only the unreserved characters are kept,
+//
+//	the slash is kept in path.
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func awsHMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func awsSHA256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func appendContentEncoding(origin, encoding string) string {
+	if origin == "" {
+		return encoding
+	}
+
+	return encoding + "," + origin
+}
+
+// bodyLength returns the length of the body, seekable bodies are not read
+func bodyLength(req *http.Request) (int64, error) {
+	if seeker, ok := req.Body.(io.Seeker); ok {
+		current, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+			return 0, err
+		}
+
+		return end - current, nil
+	}
+
+	// unknown length, buffer the body
+	if err := makeBodyReplayable(req); err != nil {
+		return 0, err
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	return io.Copy(io.Discard, body)
+}
+
+// awsChunkedLength returns the encoded length of aws-chunked body
+func awsChunkedLength(length, chunkSize int64) int64 {
+	chunkLength := func(size int64) int64 {
+		return int64(len(strconv.FormatInt(size, 16))) + int64(len(";chunk-signature=")) + 64 + 2 + size + 2
+	}
+
+	total := (length / chunkSize) * chunkLength(chunkSize)
+	if remain := length % chunkSize; remain > 0 {
+		total += chunkLength(remain)
+	}
+
+	return total + chunkLength(0)
+}
+
+// awsChunkedReader encodes the body as aws-chunked, each chunk is signed with the previous signature
+type awsChunkedReader struct {
+	body      io.ReadCloser
+	signer    *AWSSigV4Signer
+	t         time.Time
+	key       []byte
+	signature string
+	chunk     []byte
+	buf       bytes.Buffer
+	done      bool
+}
+
+func newAWSChunkedReader(body io.ReadCloser, signer *AWSSigV4Signer, t time.Time, seed string) *awsChunkedReader {
+	return &awsChunkedReader{
+		body:      body,
+		signer:    signer,
+		t:         t,
+		key:       signer.signingKey(t),
+		signature: seed,
+		chunk:     make([]byte, signer.config.StreamingChunkSize),
+	}
+}
+
+// Read implements io.Reader
+func (r *awsChunkedReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.body, r.chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+
+		if n > 0 {
+			r.writeChunk(r.chunk[:n])
+		}
+
+		// the final chunk is empty
+		if n < len(r.chunk) {
+			r.writeChunk(nil)
+			r.done = true
+		}
+	}
+
+	return r.buf.Read(p)
+}
+
+func (r *awsChunkedReader) writeChunk(data []byte) {
+	stringToSign := strings.Join([]string{
+		AWSSigV4Algorithm + "-PAYLOAD",
+		r.t.Format(awsSigV4TimeFormat),
+		r.signer.scope(r.t),
+		r.signature,
+		awsSigV4EmptySHA256,
+		awsSHA256Hex(data),
+	}, "\n")
+	r.signature = hex.EncodeToString(awsHMAC(r.key, stringToSign))
+
+	fmt.Fprintf(&r.buf, "%x;chunk-signature=%s\r\n", len(data), r.signature)
+	r.buf.Write(data)
+	r.buf.WriteString("\r\n")
+}
+
+// Close implements io.Closer
+func (r *awsChunkedReader) Close() error {
+	return r.body.Close()
+}
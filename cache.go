@@ -0,0 +1,627 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/headers"
+)
+
+// CacheStatusHit means the response is served from cache without request
+const CacheStatusHit = "HIT"
+
+// CacheStatusMiss means the response is fetched from the server
+const CacheStatusMiss = "MISS"
+
+// CacheStatusRevalidated means the cached response is revalidated by the server (304)
+const CacheStatusRevalidated = "REVALIDATED"
+
+// CacheStatusStale means the stale cached response is served,
+//
+//	by stale-while-revalidate or stale-if-error.
+const CacheStatusStale = "STALE"
+
+// CacheConfig is the config of http cache
+type CacheConfig struct {
+	// Storage is the cache storage, default in-memory LRU with 1000 entries
+	Storage CacheStorage
+	// Shared means the cache is a shared cache, which ignores private responses and prefers s-maxage,
+	//	default is a private cache.
+	Shared bool
+	// MaxEntrySize is the maximum body size of a cacheable response, zero means unlimited
+	MaxEntrySize int64
+}
+
+// Cache is the RFC 7234 http cache for GET and HEAD requests,
+//
+//	it is safe for concurrent use, and can be shared across fetches.
+type Cache struct {
+	cfg *CacheConfig
+	//
+	revalidating sync.Map
+}
+
+// cacheEntry is the stored response
+type cacheEntry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Vary is the request headers selected by the Vary response header
+	Vary map[string]string
+	//
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+// NewCache creates a http cache
+func NewCache(cfg ...*CacheConfig) *Cache {
+	config := &CacheConfig{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		*config = *cfg[0]
+	}
+
+	if config.Storage == nil {
+		config.Storage = NewMemoryCacheStorage(0)
+	}
+
+	return &Cache{
+		cfg: config,
+	}
+}
+
+// SetCache sets the http cache, which is shared by the clones
+func (f *Fetch) SetCache(cache *Cache) *Fetch {
+	f.config.Cache = cache
+	return f
+}
+
+// FromCache returns true if the response is served from cache
+func (r *Response) FromCache() bool {
+	return r.CacheStatus == CacheStatusHit || r.CacheStatus == CacheStatusRevalidated || r.CacheStatus == CacheStatusStale
+}
+
+func cacheKey(req *http.Request) string {
+	return req.URL.String()
+}
+
+func (c *Cache) load(key string) (*cacheEntry, bool) {
+	value, ok := c.cfg.Storage.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(value, entry); err != nil {
+		c.cfg.Storage.Delete(key)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+func (c *Cache) save(key string, entry *cacheEntry) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	c.cfg.Storage.Set(key, value)
+}
+
+// storable reports whether the response can be stored, see RFC 7234 section 3
+func (c *Cache) storable(req *http.Request, resp *http.Response) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+
+	// the partial content is not stored, it is not the whole response, see RFC 7233 section 4.1
+	if resp.StatusCode == http.StatusPartialContent || req.Header.Get(headers.Range) != "" {
+		return false
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	respCC := parseCacheControl(resp.Header)
+	if reqCC.has("no-store") || respCC.has("no-store") {
+		return false
+	}
+
+	if c.cfg.Shared {
+		if respCC.has("private") {
+			return false
+		}
+
+		if req.Header.Get(headers.Authorization) != "" &&
+			!respCC.has("public") && !respCC.has("s-maxage") && !respCC.has("must-revalidate") {
+			return false
+		}
+	}
+
+	if resp.Header.Get(headers.Vary) == "*" {
+		return false
+	}
+
+	explicit := respCC.has("max-age") || respCC.has("public") || resp.Header.Get(headers.Expires) != "" ||
+		(c.cfg.Shared && respCC.has("s-maxage"))
+	if !explicit && !isHeuristicallyCacheable(resp.StatusCode) {
+		return false
+	}
+
+	if c.cfg.MaxEntrySize > 0 && resp.ContentLength > c.cfg.MaxEntrySize {
+		return false
+	}
+
+	return true
+}
+
+// isHeuristicallyCacheable reports whether the status is cacheable by default, see RFC 7231 section 6.1
+func isHeuristicallyCacheable(status int) bool {
+	switch status {
+	case 200, 203, 204, 300, 301, 404, 405, 410, 414, 501:
+		return true
+	}
+
+	return false
+}
+
+// freshness returns the freshness lifetime of the entry, see RFC 7234 section 4.2.1
+func (c *Cache) freshness(entry *cacheEntry, respCC cacheControl) time.Duration {
+	if c.cfg.Shared {
+		if v, ok := respCC.seconds("s-maxage"); ok {
+			return v
+		}
+	}
+
+	if v, ok := respCC.seconds("max-age"); ok {
+		return v
+	}
+
+	date := entry.date()
+	if expires := entry.Header.Get(headers.Expires); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+
+		if lifetime := t.Sub(date); lifetime > 0 {
+			return lifetime
+		}
+
+		return 0
+	}
+
+	// heuristic freshness, 10% of the time since last modified
+	if lastModified := entry.Header.Get(headers.LastModified); lastModified != "" && isHeuristicallyCacheable(entry.Status) {
+		t, err := http.ParseTime(lastModified)
+		if err == nil && date.After(t) {
+			return date.Sub(t) / 10
+		}
+	}
+
+	return 0
+}
+
+func (e *cacheEntry) date() time.Time {
+	if date, err := http.ParseTime(e.Header.Get(headers.Date)); err == nil {
+		return date
+	}
+
+	return e.ResponseTime
+}
+
+// age returns the current age of the entry, see RFC 7234 section 4.2.3
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := e.ResponseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+
+	ageValue := time.Duration(0)
+	if v, err := strconv.ParseInt(e.Header.Get(headers.Age), 10, 64); err == nil {
+		ageValue = time.Duration(v) * time.Second
+	}
+
+	correctedAge := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	if correctedAge < apparentAge {
+		correctedAge = apparentAge
+	}
+
+	return correctedAge + now.Sub(e.ResponseTime)
+}
+
+// matchVary reports whether the request matches the selecting headers of the entry
+func (e *cacheEntry) matchVary(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *cacheEntry) response(req *http.Request, age time.Duration) *http.Response {
+	header := e.Header.Clone()
+	header.Set(headers.Age, strconv.Itoa(int(age.Seconds())))
+
+	var body io.ReadCloser = http.NoBody
+	if req.Method != http.MethodHead {
+		body = io.NopCloser(bytes.NewReader(e.Body))
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(e.Status) + " " + http.StatusText(e.Status),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// update updates the entry by the 304 response, see RFC 7234 section 4.3.4
+func (e *cacheEntry) update(resp *http.Response, requestTime, responseTime time.Time) {
+	for name, values := range resp.Header {
+		if strings.EqualFold(name, headers.ContentLength) {
+			continue
+		}
+
+		e.Header[name] = values
+	}
+
+	e.RequestTime = requestTime
+	e.ResponseTime = responseTime
+}
+
+// store reads the response body and stores it if storable,
+//
+//	the body of returned response is replaced by the buffered one.
+func (c *Cache) store(req *http.Request, key string, resp *http.Response, requestTime, responseTime time.Time) (*http.Response, error) {
+	if !c.storable(req, resp) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if c.cfg.MaxEntrySize > 0 && int64(len(body)) > c.cfg.MaxEntrySize {
+		return resp, nil
+	}
+
+	entry := &cacheEntry{
+		Status:       resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+
+	if vary := resp.Header.Get(headers.Vary); vary != "" {
+		entry.Vary = make(map[string]string)
+		for _, name := range strings.Split(vary, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" {
+				entry.Vary[name] = req.Header.Get(name)
+			}
+		}
+	}
+
+	// useless without freshness, validators or staleness extensions
+	respCC := parseCacheControl(entry.Header)
+	if c.freshness(entry, respCC) == 0 &&
+		entry.Header.Get(headers.ETag) == "" && entry.Header.Get(headers.LastModified) == "" &&
+		!respCC.has("stale-while-revalidate") && !respCC.has("stale-if-error") {
+		return resp, nil
+	}
+
+	c.save(key, entry)
+	return resp, nil
+}
+
+// revalidate sends the conditional request and updates the entry,
+//
+//	revalidated is true if the server answers 304 Not Modified.
+func (c *Cache) revalidate(req *http.Request, key string, entry *cacheEntry, next http.RoundTripper) (resp *http.Response, revalidated bool, err error) {
+	condReq := req.Clone(req.Context())
+	if etag := entry.Header.Get(headers.ETag); etag != "" {
+		condReq.Header.Set(headers.IfNoneMatch, etag)
+	}
+	if lastModified := entry.Header.Get(headers.LastModified); lastModified != "" {
+		condReq.Header.Set(headers.IfModifiedSince, lastModified)
+	}
+
+	requestTime := time.Now()
+	resp, err = next.RoundTrip(condReq)
+	if err != nil {
+		return nil, false, err
+	}
+	responseTime := time.Now()
+
+	if resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		entry.update(resp, requestTime, responseTime)
+		c.save(key, entry)
+		return entry.response(req, entry.age(responseTime)), true, nil
+	}
+
+	resp, err = c.store(req, key, resp, requestTime, responseTime)
+	return resp, false, err
+}
+
+// revalidateInBackground revalidates the entry for stale-while-revalidate,
+//
+//	only one revalidation for the same key at the same time.
+func (c *Cache) revalidateInBackground(req *http.Request, key string, entry *cacheEntry, next http.RoundTripper) {
+	if _, loaded := c.revalidating.LoadOrStore(key, true); loaded {
+		return
+	}
+
+	go func() {
+		defer c.revalidating.Delete(key)
+
+		// the values like the proxy selector are kept, while the own attempts counter is used
+		ctx := withAttempts(withoutCancel(req.Context()), new(int))
+		resp, _, err := c.revalidate(req.Clone(ctx), key, entry, next)
+		if err != nil {
+			return
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// detachedContext keeps the values of the parent, but is never canceled,
+//
+//	like context.WithoutCancel of Go 1.21.
+type detachedContext struct {
+	parent context.Context
+}
+
+func withoutCancel(parent context.Context) context.Context {
+	return detachedContext{parent: parent}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// cacher serves the request from cache, created for each execution
+type cacher struct {
+	cache *Cache
+	next  http.RoundTripper
+	// status is the cache status of the last round trip
+	status string
+}
+
+func newCacher(cache *Cache, next http.RoundTripper) *cacher {
+	return &cacher{
+		cache: cache,
+		next:  next,
+	}
+}
+
+// cacheStatus returns the cache status of the execution, empty if cache is disabled
+func cacheStatus(t *cacher) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.status
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *cacher) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.cache
+	key := cacheKey(req)
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		t.status = ""
+		resp, err := t.next.RoundTrip(req)
+		// unsafe methods invalidate the cached response, see RFC 7234 section 4.4
+		if err == nil && resp.StatusCode < 400 {
+			c.cfg.Storage.Delete(key)
+		}
+
+		return resp, err
+	}
+
+	// the range request is not served from the whole response cached
+	if req.Header.Get(headers.Range) != "" {
+		t.status = ""
+		return t.next.RoundTrip(req)
+	}
+
+	reqCC := parseCacheControl(req.Header)
+
+	entry, ok := c.load(key)
+	if ok && !entry.matchVary(req) {
+		ok = false
+	}
+
+	if !ok || reqCC.has("no-store") {
+		if reqCC.has("only-if-cached") {
+			t.status = CacheStatusMiss
+			return newGatewayTimeoutResponse(req), nil
+		}
+
+		t.status = CacheStatusMiss
+		requestTime := time.Now()
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.store(req, key, resp, requestTime, time.Now())
+	}
+
+	now := time.Now()
+	respCC := parseCacheControl(entry.Header)
+	age := entry.age(now)
+	lifetime := c.freshness(entry, respCC)
+
+	if isFresh(age, lifetime, reqCC, respCC) {
+		t.status = CacheStatusHit
+		return entry.response(req, age), nil
+	}
+
+	if reqCC.has("only-if-cached") {
+		t.status = CacheStatusMiss
+		return newGatewayTimeoutResponse(req), nil
+	}
+
+	canServeStale := !respCC.has("must-revalidate") && !respCC.has("no-cache") &&
+		!(c.cfg.Shared && respCC.has("proxy-revalidate"))
+
+	// stale-while-revalidate, see RFC 5861
+	if swr, ok := respCC.seconds("stale-while-revalidate"); ok && canServeStale && age < lifetime+swr {
+		t.status = CacheStatusStale
+		c.revalidateInBackground(req, key, entry, t.next)
+		return entry.response(req, age), nil
+	}
+
+	resp, revalidated, err := c.revalidate(req, key, entry, t.next)
+	if err != nil || resp.StatusCode >= 500 {
+		// stale-if-error, see RFC 5861
+		sie, ok := respCC.seconds("stale-if-error")
+		if v, rok := reqCC.seconds("stale-if-error"); rok {
+			sie, ok = v, true
+		}
+
+		if ok && canServeStale && age < lifetime+sie {
+			if resp != nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+
+			t.status = CacheStatusStale
+			return entry.response(req, age), nil
+		}
+
+		t.status = CacheStatusMiss
+		return resp, err
+	}
+
+	t.status = CacheStatusMiss
+	if revalidated {
+		t.status = CacheStatusRevalidated
+	}
+
+	return resp, nil
+}
+
+// isFresh reports whether the entry can be served without revalidation
+func isFresh(age, lifetime time.Duration, reqCC, respCC cacheControl) bool {
+	if reqCC.has("no-cache") || respCC.has("no-cache") {
+		return false
+	}
+
+	if maxAge, ok := reqCC.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok {
+		age += minFresh
+	}
+
+	if age < lifetime {
+		return true
+	}
+
+	// max-stale without value means any staleness is acceptable
+	if value, ok := reqCC["max-stale"]; ok && !respCC.has("must-revalidate") {
+		if value == "" {
+			return true
+		}
+
+		if maxStale, ok := reqCC.seconds("max-stale"); ok && age < lifetime+maxStale {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newGatewayTimeoutResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 " + http.StatusText(http.StatusGatewayTimeout),
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// cacheControl is the parsed Cache-Control directives
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range h.Values(headers.CacheControl) {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			kv := strings.SplitN(directive, "=", 2)
+			name := strings.ToLower(strings.TrimSpace(kv[0]))
+			if len(kv) == 2 {
+				cc[name] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			} else {
+				cc[name] = ""
+			}
+		}
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
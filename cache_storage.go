@@ -0,0 +1,164 @@
+package fetch
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStorage is the storage of http cache, the value is the serialized cache entry
+type CacheStorage interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte) error
+	Delete(key string) error
+}
+
+// MemoryCacheStorage is the in-memory LRU cache storage
+type MemoryCacheStorage struct {
+	capacity int
+	//
+	sync.Mutex
+	items *list.List
+	index map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCacheStorage creates an in-memory LRU cache storage,
+//
+//	which keeps at most capacity entries, zero means 1000.
+func NewMemoryCacheStorage(capacity int) *MemoryCacheStorage {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+
+	return &MemoryCacheStorage{
+		capacity: capacity,
+		items:    list.New(),
+		index:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of the key
+func (s *MemoryCacheStorage) Get(key string) ([]byte, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	el, ok := s.index[key]
+	if !ok {
+		return nil, false
+	}
+
+	s.items.MoveToFront(el)
+	return el.Value.(*memoryCacheItem).value, true
+}
+
+// Set sets the value of the key, evicts the least recently used entry if full
+func (s *MemoryCacheStorage) Set(key string, value []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if el, ok := s.index[key]; ok {
+		el.Value.(*memoryCacheItem).value = value
+		s.items.MoveToFront(el)
+		return nil
+	}
+
+	s.index[key] = s.items.PushFront(&memoryCacheItem{key, value})
+
+	for s.items.Len() > s.capacity {
+		oldest := s.items.Back()
+		s.items.Remove(oldest)
+		delete(s.index, oldest.Value.(*memoryCacheItem).key)
+	}
+
+	return nil
+}
+
+// Delete deletes the key
+func (s *MemoryCacheStorage) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if el, ok := s.index[key]; ok {
+		s.items.Remove(el)
+		delete(s.index, key)
+	}
+
+	return nil
+}
+
+// Len returns the number of entries
+func (s *MemoryCacheStorage) Len() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.items.Len()
+}
+
+// DiskCacheStorage is the on-disk cache storage, one file per entry
+type DiskCacheStorage struct {
+	dir string
+}
+
+// NewDiskCacheStorage creates an on-disk cache storage in the directory
+func NewDiskCacheStorage(dir string) (*DiskCacheStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &DiskCacheStorage{
+		dir: dir,
+	}, nil
+}
+
+func (s *DiskCacheStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the value of the key
+func (s *DiskCacheStorage) Get(key string) ([]byte, bool) {
+	value, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// Set sets the value of the key, the file is replaced atomically
+func (s *DiskCacheStorage) Set(key string, value []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+// Delete deletes the key
+func (s *DiskCacheStorage) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,365 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func TestCacheMaxAge(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(fmt.Sprintf("response %d", n)))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache())
+
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, CacheStatusMiss, response.CacheStatus)
+	testify.Assert(t, !response.FromCache())
+
+	response, err = f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, CacheStatusHit, response.CacheStatus)
+	testify.Assert(t, response.FromCache())
+	testify.Equal(t, "response 1", response.String())
+	testify.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// HEAD is served from the GET response
+	response, err = f.Clone().Head("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, CacheStatusHit, response.CacheStatus)
+	testify.Equal(t, "", response.String())
+
+	// request no-cache forces revalidation
+	response, err = f.Clone().Get("/", &Config{Headers: Headers{"Cache-Control": "no-cache"}}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, CacheStatusMiss, response.CacheStatus)
+	testify.Equal(t, "response 2", response.String())
+}
+
+func TestCacheRevalidateETag(t *testing.T) {
+	var count, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache())
+	for i := 0; i < 3; i++ {
+		response, err := f.Clone().Get("/").Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, http.StatusOK, response.Status)
+		testify.Equal(t, "hello", response.String())
+		if i > 0 {
+			testify.Equal(t, CacheStatusRevalidated, response.CacheStatus)
+		}
+	}
+
+	testify.Equal(t, int32(3), atomic.LoadInt32(&count))
+	testify.Equal(t, int32(2), atomic.LoadInt32(&notModified))
+}
+
+func TestCacheRevalidateLastModified(t *testing.T) {
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache())
+	f.Clone().Get("/").Execute()
+
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, CacheStatusRevalidated, response.CacheStatus)
+	testify.Equal(t, "hello", response.String())
+}
+
+func TestCacheVary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept")
+		w.Write([]byte(r.Header.Get("Accept")))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache())
+	f.Clone().SetAccept("application/json").Get("/").Execute()
+
+	response, _ := f.Clone().SetAccept("application/json").Get("/").Execute()
+	testify.Equal(t, CacheStatusHit, response.CacheStatus)
+
+	response, _ = f.Clone().SetAccept("text/plain").Get("/").Execute()
+	testify.Equal(t, CacheStatusMiss, response.CacheStatus)
+	testify.Equal(t, "text/plain", response.String())
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache())
+	f.Clone().Get("/").Execute()
+
+	atomic.StoreInt32(&failing, 1)
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, CacheStatusStale, response.CacheStatus)
+	testify.Equal(t, http.StatusOK, response.Status)
+	testify.Equal(t, "hello", response.String())
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		w.Write([]byte(fmt.Sprintf("response %d", n)))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache())
+	f.Clone().Get("/").Execute()
+
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, CacheStatusStale, response.CacheStatus)
+	testify.Equal(t, "response 1", response.String())
+
+	// revalidated in background
+	for i := 0; i < 100 && atomic.LoadInt32(&count) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	testify.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+func TestCacheStaleWhileRevalidateProxy(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		w.Write([]byte(fmt.Sprintf("response %d", n)))
+	}))
+	defer server.Close()
+
+	var hits int32
+	proxy := newProxyServer("", &hits)
+	defer proxy.Close()
+
+	f := Create(server.URL).SetCache(NewCache()).SetProxy(proxy.URL)
+	f.Clone().Get("/").Execute()
+
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, CacheStatusStale, response.CacheStatus)
+
+	// revalidated in background through the proxy
+	for i := 0; i < 100 && atomic.LoadInt32(&count) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	testify.Equal(t, int32(2), atomic.LoadInt32(&count))
+	testify.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestCacheNoStoreAndInvalidation(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if r.URL.Path == "/no-store" {
+			w.Header().Set("Cache-Control", "no-store")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache())
+
+	f.Clone().Get("/no-store").Execute()
+	response, _ := f.Clone().Get("/no-store").Execute()
+	testify.Equal(t, CacheStatusMiss, response.CacheStatus)
+
+	f.Clone().Get("/resource").Execute()
+	response, _ = f.Clone().Get("/resource").Execute()
+	testify.Equal(t, CacheStatusHit, response.CacheStatus)
+
+	f.Clone().Delete("/resource").Execute()
+	response, _ = f.Clone().Get("/resource").Execute()
+	testify.Equal(t, CacheStatusMiss, response.CacheStatus)
+}
+
+func TestCacheRange(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Path == "/partial" || r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", "bytes 0-1/10")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("01"))
+			return
+		}
+		w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache())
+
+	// 206 is not stored
+	f.Clone().Get("/partial").Execute()
+	response, _ := f.Clone().Get("/partial").Execute()
+	testify.Equal(t, CacheStatusMiss, response.CacheStatus)
+	testify.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	// the range request is neither stored nor served from the whole response
+	response, _ = f.Clone().Get("/", &Config{Headers: Headers{"Range": "bytes=0-1"}}).Execute()
+	testify.Equal(t, http.StatusPartialContent, response.Status)
+	response, _ = f.Clone().Get("/").Execute()
+	testify.Equal(t, CacheStatusMiss, response.CacheStatus)
+	testify.Equal(t, "0123456789", response.String())
+
+	response, _ = f.Clone().Get("/", &Config{Headers: Headers{"Range": "bytes=0-1"}}).Execute()
+	testify.Equal(t, http.StatusPartialContent, response.Status)
+	testify.Equal(t, "01", response.String())
+	testify.Equal(t, int32(5), atomic.LoadInt32(&count))
+}
+
+func TestCacheOnlyIfCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	response, err := Create(server.URL).
+		SetCache(NewCache()).
+		SetCacheControl("only-if-cached").
+		Get("/").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusGatewayTimeout, response.Status)
+}
+
+func TestMemoryCacheStorageLRU(t *testing.T) {
+	s := NewMemoryCacheStorage(2)
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Get("a")
+	s.Set("c", []byte("3"))
+
+	_, ok := s.Get("b")
+	testify.Assert(t, !ok, "Expected b to be evicted")
+
+	v, ok := s.Get("a")
+	testify.Assert(t, ok)
+	testify.Equal(t, "1", string(v))
+	testify.Equal(t, 2, s.Len())
+
+	s.Delete("a")
+	_, ok = s.Get("a")
+	testify.Assert(t, !ok)
+}
+
+func TestDiskCacheStorage(t *testing.T) {
+	s, err := NewDiskCacheStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set("https://example.com/a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := s.Get("https://example.com/a")
+	testify.Assert(t, ok)
+	testify.Equal(t, "hello", string(v))
+
+	if err := s.Delete("https://example.com/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok = s.Get("https://example.com/a")
+	testify.Assert(t, !ok)
+
+	// cache with disk storage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetCache(NewCache(&CacheConfig{Storage: s}))
+	f.Clone().Get("/").Execute()
+	response, _ := f.Clone().Get("/").Execute()
+	testify.Equal(t, CacheStatusHit, response.CacheStatus)
+	testify.Equal(t, "ok", response.String())
+}
+
+func TestParseCacheControl(t *testing.T) {
+	h := http.Header{}
+	h.Set("Cache-Control", `public, max-age=60, no-cache="Set-Cookie"`)
+
+	cc := parseCacheControl(h)
+	testify.Assert(t, cc.has("public"))
+	testify.Equal(t, "Set-Cookie", cc["no-cache"])
+
+	maxAge, ok := cc.seconds("max-age")
+	testify.Assert(t, ok)
+	testify.Equal(t, time.Minute, maxAge)
+}
@@ -0,0 +1,301 @@
+package fetch
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/core-utils/fmt"
+)
+
+// CircuitState is the state of circuit
+type CircuitState int
+
+const (
+	// CircuitClosed means requests are allowed
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means requests are rejected immediately with ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen means limited trial requests are allowed to probe the recovery
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerKeyHost means one circuit per host
+const CircuitBreakerKeyHost = "host"
+
+// CircuitBreakerKeyBaseURL means one circuit per base url, falls back to host if base url is empty
+const CircuitBreakerKeyBaseURL = "baseurl"
+
+// circuitBuckets is the number of buckets in the rolling window
+const circuitBuckets = 10
+
+// CircuitBreakerConfig is the config of circuit breaker
+type CircuitBreakerConfig struct {
+	// KeyBy is how circuits are keyed, CircuitBreakerKeyHost (default) or CircuitBreakerKeyBaseURL
+	KeyBy string
+	// Window is the rolling window of failure rate, default 10s
+	Window time.Duration
+	// MinRequests is the minimum number of requests in the window before the circuit can open, default 10
+	MinRequests int
+	// FailureRate is the failure rate (0 ~ 1) which opens the circuit, default 0.5
+	FailureRate float64
+	// OpenTimeout is how long the circuit stays open before half-open, default 30s
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of trial requests in half-open state, default 1,
+	//	all of them succeed closes the circuit, any failure opens it again.
+	HalfOpenRequests int
+	// IsFailure reports whether the result is a failure, default error or 5xx status
+	IsFailure func(status int, err error) bool
+	// OnStateChange is called when the state of circuit changes
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+// CircuitBreaker rejects requests to an unhealthy host immediately,
+//
+//	it is safe for concurrent use, and can be shared across fetches.
+type CircuitBreaker struct {
+	cfg *CircuitBreakerConfig
+	//
+	sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state      CircuitState
+	generation int
+	openedAt   time.Time
+	//
+	buckets [circuitBuckets]circuitBucket
+	//
+	halfOpenInFlight  int
+	halfOpenSuccesses int
+}
+
+type circuitBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+type circuitTransition struct {
+	key      string
+	from, to CircuitState
+}
+
+// NewCircuitBreaker creates a circuit breaker
+func NewCircuitBreaker(cfg ...*CircuitBreakerConfig) *CircuitBreaker {
+	config := &CircuitBreakerConfig{}
+	if len(cfg) > 0 && cfg[0] != nil {
+		*config = *cfg[0]
+	}
+
+	if config.KeyBy == "" {
+		config.KeyBy = CircuitBreakerKeyHost
+	}
+	if config.Window == 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.MinRequests == 0 {
+		config.MinRequests = 10
+	}
+	if config.FailureRate == 0 {
+		config.FailureRate = 0.5
+	}
+	if config.OpenTimeout == 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenRequests == 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(status int, err error) bool {
+			return err != nil || status >= http.StatusInternalServerError
+		}
+	}
+
+	return &CircuitBreaker{
+		cfg:      config,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// SetCircuitBreaker sets the circuit breaker, which is shared by the clones
+func (f *Fetch) SetCircuitBreaker(cb *CircuitBreaker) *Fetch {
+	f.config.CircuitBreaker = cb
+	return f
+}
+
+// State returns the state of the circuit
+func (cb *CircuitBreaker) State(key string) CircuitState {
+	cb.Lock()
+	defer cb.Unlock()
+
+	c, ok := cb.circuits[key]
+	if !ok {
+		return CircuitClosed
+	}
+
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= cb.cfg.OpenTimeout {
+		return CircuitHalfOpen
+	}
+
+	return c.state
+}
+
+// Key returns the circuit key of the request
+func (cb *CircuitBreaker) Key(config *Config, req *http.Request) string {
+	if cb.cfg.KeyBy == CircuitBreakerKeyBaseURL && config.BaseURL != "" {
+		return config.BaseURL
+	}
+
+	return req.URL.Host
+}
+
+// Allow reports whether the request to the circuit is allowed,
+//
+//	if allowed, done must be called with the result of request.
+func (cb *CircuitBreaker) Allow(key string) (done func(status int, err error), err error) {
+	var transitions []circuitTransition
+	defer func() {
+		cb.notify(transitions)
+	}()
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[key] = c
+	}
+
+	now := time.Now()
+	if c.state == CircuitOpen {
+		if now.Sub(c.openedAt) < cb.cfg.OpenTimeout {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+		}
+
+		transitions = append(transitions, cb.transit(key, c, CircuitHalfOpen, now))
+	}
+
+	if c.state == CircuitHalfOpen {
+		if c.halfOpenInFlight >= cb.cfg.HalfOpenRequests {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+		}
+
+		c.halfOpenInFlight++
+	}
+
+	generation := c.generation
+	return func(status int, err error) {
+		cb.done(key, c, generation, cb.cfg.IsFailure(status, err))
+	}, nil
+}
+
+func (cb *CircuitBreaker) done(key string, c *circuit, generation int, failed bool) {
+	var transitions []circuitTransition
+	defer func() {
+		cb.notify(transitions)
+	}()
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	// the state has changed since the request was allowed
+	if c.generation != generation {
+		return
+	}
+
+	now := time.Now()
+	switch c.state {
+	case CircuitHalfOpen:
+		c.halfOpenInFlight--
+		if failed {
+			transitions = append(transitions, cb.transit(key, c, CircuitOpen, now))
+			return
+		}
+
+		c.halfOpenSuccesses++
+		if c.halfOpenSuccesses >= cb.cfg.HalfOpenRequests {
+			transitions = append(transitions, cb.transit(key, c, CircuitClosed, now))
+		}
+	case CircuitClosed:
+		bucket := c.bucket(now, cb.cfg.Window)
+		if failed {
+			bucket.failures++
+		} else {
+			bucket.successes++
+		}
+
+		successes, failures := c.counts(now, cb.cfg.Window)
+		total := successes + failures
+		if total >= cb.cfg.MinRequests && float64(failures)/float64(total) >= cb.cfg.FailureRate {
+			transitions = append(transitions, cb.transit(key, c, CircuitOpen, now))
+		}
+	}
+}
+
+func (cb *CircuitBreaker) transit(key string, c *circuit, to CircuitState, now time.Time) circuitTransition {
+	from := c.state
+
+	c.state = to
+	c.generation++
+	c.halfOpenInFlight = 0
+	c.halfOpenSuccesses = 0
+	if to == CircuitOpen {
+		c.openedAt = now
+	}
+	if to == CircuitClosed {
+		c.buckets = [circuitBuckets]circuitBucket{}
+	}
+
+	return circuitTransition{key, from, to}
+}
+
+func (cb *CircuitBreaker) notify(transitions []circuitTransition) {
+	if cb.cfg.OnStateChange == nil {
+		return
+	}
+
+	for _, t := range transitions {
+		cb.cfg.OnStateChange(t.key, t.from, t.to)
+	}
+}
+
+// bucket returns the bucket of now in the rolling window
+func (c *circuit) bucket(now time.Time, window time.Duration) *circuitBucket {
+	size := window / circuitBuckets
+	start := now.Truncate(size)
+	b := &c.buckets[int(start.UnixNano()/int64(size))%circuitBuckets]
+	if !b.start.Equal(start) {
+		*b = circuitBucket{start: start}
+	}
+
+	return b
+}
+
+// counts returns the successes and failures in the rolling window
+func (c *circuit) counts(now time.Time, window time.Duration) (successes, failures int) {
+	for _, b := range c.buckets {
+		if now.Sub(b.start) < window {
+			successes += b.successes
+			failures += b.failures
+		}
+	}
+
+	return
+}
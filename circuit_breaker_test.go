@@ -0,0 +1,111 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy int32
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var transitions []string
+	cb := NewCircuitBreaker(&CircuitBreakerConfig{
+		MinRequests: 2,
+		FailureRate: 0.5,
+		OpenTimeout: 50 * time.Millisecond,
+		OnStateChange: func(key string, from, to CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+
+	f := Create(server.URL).SetCircuitBreaker(cb)
+	key := strings.TrimPrefix(server.URL, "http://")
+
+	for i := 0; i < 2; i++ {
+		response, err := f.Clone().Get("/").Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, http.StatusInternalServerError, response.Status)
+	}
+	testify.Equal(t, CircuitOpen, cb.State(key))
+
+	// rejected immediately while open
+	_, err := f.Clone().Get("/").Execute()
+	testify.Assert(t, errors.Is(err, ErrCircuitOpen), "Expected ErrCircuitOpen")
+	testify.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	// half-open after timeout, trial succeeds closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "ok", response.String())
+	testify.Equal(t, CircuitClosed, cb.State(key))
+
+	mu.Lock()
+	defer mu.Unlock()
+	testify.Equal(t, "closed->open,open->half-open,half-open->closed", strings.Join(transitions, ","))
+}
+
+func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
+	cb := NewCircuitBreaker(&CircuitBreakerConfig{
+		MinRequests: 1,
+		OpenTimeout: 10 * time.Millisecond,
+	})
+
+	done, err := cb.Allow("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(0, errors.New("connection refused"))
+	testify.Equal(t, CircuitOpen, cb.State("host"))
+
+	time.Sleep(20 * time.Millisecond)
+	testify.Equal(t, CircuitHalfOpen, cb.State("host"))
+
+	done, err = cb.Allow("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only one trial request in half-open
+	_, err = cb.Allow("host")
+	testify.Assert(t, errors.Is(err, ErrCircuitOpen), "Expected ErrCircuitOpen")
+
+	done(http.StatusBadGateway, nil)
+	testify.Equal(t, CircuitOpen, cb.State("host"))
+}
+
+func TestCircuitBreakerKeyByBaseURL(t *testing.T) {
+	cb := NewCircuitBreaker(&CircuitBreakerConfig{KeyBy: CircuitBreakerKeyBaseURL})
+
+	req, _ := http.NewRequest(GET, "https://example.com/api/users", nil)
+	testify.Equal(t, "https://example.com/api", cb.Key(&Config{BaseURL: "https://example.com/api"}, req))
+	testify.Equal(t, "example.com", cb.Key(&Config{}, req))
+}
@@ -2,6 +2,8 @@ package fetch
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -14,19 +16,61 @@ type Config struct {
 	Query   Query
 	Params  Params
 	Body    Body
+	// HeaderValues are the multi-value headers, which are added after Headers,
+	//	like multiple Accept or X-Forwarded-For
+	HeaderValues http.Header
+	// QueryValues are the multi-value query, which are added after Query, like ?id=1&id=2
+	QueryValues url.Values
+	// ParamValues are the params of the url template (RFC 6570), which take precedence over Params,
+	//	the value is string, []string (list) or map[string]string (associative array)
+	ParamValues map[string]interface{}
+	// StrictParams reports an error of the unresolved {name} and /:name in the url template
+	StrictParams bool
+	// QueryObject is the tagged struct or map which is encoded into the query, see EncodeQuery
+	QueryObject interface{}
+	// ArrayFormat is the encoding style of slices in QueryObject and form body, default is ArrayFormatRepeat
+	ArrayFormat ArrayFormat
 	//
 	BaseURL string
+	// Timeout is the total timeout of the request, including reading the body
 	Timeout time.Duration
+	// DialTimeout is the timeout of establishing the TCP connection, zero means DefaultDialTimeout
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout is the timeout of the TLS handshake, zero means DefaultTLSHandshakeTimeout
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout is the timeout of waiting for the response headers after the request is written,
+	//	zero means no timeout
+	ResponseHeaderTimeout time.Duration
+	// IdleReadTimeout is the maximum idle time between reads of the response body,
+	//	zero means no timeout
+	IdleReadTimeout time.Duration
+	// Trace collects the timing of the request into Response.Timing
+	Trace bool
 	//
 	DownloadFilePath string
-	//
+	// Proxy is the proxy url, like http://127.0.0.1:17890, socks5://127.0.0.1:17890,
+	//	or ProxyEnvironment (default), ProxyDirect
 	Proxy string
+	// NoProxy are the hosts which bypass the proxy, see ProxyRule.Hosts for the patterns
+	NoProxy []string
+	// ProxyRules select the proxy by the destination, the first matched rule is used
+	ProxyRules []ProxyRule
+	// ProxyFunc selects the proxy of each request, it takes precedence over Proxy, NoProxy and ProxyRules
+	ProxyFunc func(req *http.Request) (*url.URL, error) `json:"-"`
+	// ProxyAuth is the credentials of the proxy, if the proxy url has no user info
+	ProxyAuth BasicAuth `json:"-"`
+	// ProxyHeaders are the headers to the proxy, in the CONNECT request for https,
+	//	or in the request itself for http via HTTP proxy
+	ProxyHeaders Headers `json:"-"`
 	//
 	IsStream bool
 	//
 	IsSession bool
-	//
+	// HTTP2 forces HTTP/2 over TLS
 	HTTP2 bool
+	// H2C enables HTTP/2 over cleartext TCP for http:// urls,
+	//	available values: H2CPriorKnowledge, H2CUpgrade
+	H2C string
 
 	// TLS Ca Cert
 	TLSCaCert     []byte
@@ -44,17 +88,87 @@ type Config struct {
 	TLSInsecureSkipVerify bool
 	// UnixDomainSocket socket like /var/run/docker.sock
 	UnixDomainSocket string
+	// HostOverrides dials the address instead of the host, like curl --resolve and --connect-to,
+	//	the key is host:port or host, the value is ip, ip:port or host:port,
+	//	the Host header and TLS SNI are kept, ignored for UnixDomainSocket,
+	//	the proxy address is overridden instead if the proxy is used.
+	HostOverrides map[string]string
+	// Resolver resolves the host to dial, default net.DefaultResolver
+	Resolver Resolver `json:"-"`
+	// LocalAddr is the local ip to dial from
+	LocalAddr string
+	// Interface is the local network interface to dial from, like eth0
+	Interface string
 	//
 	Context context.Context
 	//
 	OnProgress OnProgress
 	//
 	BasicAuth BasicAuth
+	// DigestAuth answers the HTTP Digest challenge, shared by the clones
+	DigestAuth *DigestAuth `json:"-"`
+	// OAuth2 acquires and refreshes the OAuth2 token, shared by the clones
+	OAuth2 *OAuth2TokenSource `json:"-"`
+	// AWSSigV4 signs the requests by AWS Signature Version 4
+	AWSSigV4 *AWSSigV4Signer `json:"-"`
+	// Signer signs the fully built request
+	Signer Signer `json:"-"`
 	//
 	Username string
 	Password string
 	//
 	CompressRequest bool
+
+	// MaxIdleConns controls the maximum number of idle (keep-alive) connections across all hosts,
+	//	zero means DefaultMaxIdleConns
+	MaxIdleConns int
+	// MaxIdleConnsPerHost controls the maximum idle (keep-alive) connections to keep per-host,
+	//	zero means http.DefaultMaxIdleConnsPerHost
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the total number of connections per host, zero means no limit
+	MaxConnsPerHost int
+	// IdleConnTimeout is the maximum amount of time an idle connection will remain idle before closing itself,
+	//	zero means DefaultIdleConnTimeout
+	IdleConnTimeout time.Duration
+	// KeepAlive specifies the interval between keep-alive probes for an active connection,
+	//	zero means DefaultKeepAlive
+	KeepAlive time.Duration
+	// DisableKeepAlives disables HTTP keep-alives, only use the connection to the server for a single request
+	DisableKeepAlives bool
+
+	// RetryPolicy retries the failed request with backoff
+	RetryPolicy *RetryPolicy
+
+	// FailOnStatus makes Execute return *HTTPError together with the response for the failure statuses
+	FailOnStatus bool
+	// FailStatusRanges are the failure statuses, default all non-2xx statuses
+	FailStatusRanges []StatusRange
+	// ExpectedStatuses are never failures, even if they are in FailStatusRanges, like 404
+	ExpectedStatuses []int
+
+	// CircuitBreaker rejects requests to unhealthy hosts immediately
+	CircuitBreaker *CircuitBreaker `json:"-"`
+
+	// RateLimiter limits the rate and concurrency of requests
+	RateLimiter *RateLimiter `json:"-"`
+
+	// Cache is the RFC 7234 http cache for GET and HEAD requests
+	Cache *Cache `json:"-"`
+
+	// CookieJar stores the cookies of the session, shared by the clones
+	CookieJar *CookieJar `json:"-"`
+	// RedirectPolicy controls how redirects are followed
+	RedirectPolicy *RedirectPolicy `json:"-"`
+
+	// SessionStore persists the session across process restarts
+	SessionStore SessionStore `json:"-"`
+
+	// Middlewares wraps the whole exchange, round-tripper style
+	Middlewares []Middleware `json:"-"`
+	// RequestInterceptors intercepts the built request before it is sent
+	RequestInterceptors []RequestInterceptor `json:"-"`
+	// ResponseInterceptors intercepts the response before it is returned
+	ResponseInterceptors []ResponseInterceptor `json:"-"`
 }
 
 // BasicAuth is the basic auth
@@ -115,6 +229,30 @@ func (c *Config) Merge(config *Config) {
 		}
 	}
 
+	if config.HeaderValues != nil {
+		if c.HeaderValues == nil {
+			c.HeaderValues = make(http.Header)
+		}
+
+		for key, values := range config.HeaderValues {
+			if _, ok := c.HeaderValues[key]; !ok {
+				c.HeaderValues[key] = append([]string{}, values...)
+			}
+		}
+	}
+
+	if config.QueryValues != nil {
+		if c.QueryValues == nil {
+			c.QueryValues = make(url.Values)
+		}
+
+		for key, values := range config.QueryValues {
+			if _, ok := c.QueryValues[key]; !ok {
+				c.QueryValues[key] = append([]string{}, values...)
+			}
+		}
+	}
+
 	if config.Params != nil {
 		if c.Params == nil {
 			c.Params = make(Params)
@@ -127,6 +265,30 @@ func (c *Config) Merge(config *Config) {
 		}
 	}
 
+	if config.ParamValues != nil {
+		if c.ParamValues == nil {
+			c.ParamValues = make(map[string]interface{})
+		}
+
+		for param, value := range config.ParamValues {
+			if _, ok := c.ParamValues[param]; !ok {
+				c.ParamValues[param] = value
+			}
+		}
+	}
+
+	if config.StrictParams {
+		c.StrictParams = config.StrictParams
+	}
+
+	if config.QueryObject != nil {
+		c.QueryObject = config.QueryObject
+	}
+
+	if config.ArrayFormat != "" {
+		c.ArrayFormat = config.ArrayFormat
+	}
+
 	if config.Body != nil {
 		c.Body = config.Body
 	}
@@ -139,6 +301,26 @@ func (c *Config) Merge(config *Config) {
 		c.Timeout = config.Timeout
 	}
 
+	if config.DialTimeout != 0 {
+		c.DialTimeout = config.DialTimeout
+	}
+
+	if config.TLSHandshakeTimeout != 0 {
+		c.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+	}
+
+	if config.ResponseHeaderTimeout != 0 {
+		c.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	}
+
+	if config.IdleReadTimeout != 0 {
+		c.IdleReadTimeout = config.IdleReadTimeout
+	}
+
+	if config.Trace {
+		c.Trace = config.Trace
+	}
+
 	if config.DownloadFilePath != "" {
 		c.DownloadFilePath = config.DownloadFilePath
 	}
@@ -147,6 +329,32 @@ func (c *Config) Merge(config *Config) {
 		c.Proxy = config.Proxy
 	}
 
+	if config.NoProxy != nil {
+		c.NoProxy = config.NoProxy
+	}
+
+	if config.ProxyRules != nil {
+		c.ProxyRules = config.ProxyRules
+	}
+
+	if config.ProxyFunc != nil {
+		c.ProxyFunc = config.ProxyFunc
+	}
+
+	if config.ProxyAuth.Username != "" || config.ProxyAuth.Password != "" {
+		c.ProxyAuth = config.ProxyAuth
+	}
+
+	if config.ProxyHeaders != nil {
+		if c.ProxyHeaders == nil {
+			c.ProxyHeaders = make(Headers)
+		}
+
+		for key, value := range config.ProxyHeaders {
+			c.ProxyHeaders[key] = value
+		}
+	}
+
 	if config.TLSCaCert != nil {
 		c.TLSCaCert = config.TLSCaCert
 	}
@@ -175,6 +383,28 @@ func (c *Config) Merge(config *Config) {
 		c.TLSInsecureSkipVerify = config.TLSInsecureSkipVerify
 	}
 
+	if config.HostOverrides != nil {
+		if c.HostOverrides == nil {
+			c.HostOverrides = make(map[string]string)
+		}
+
+		for host, addr := range config.HostOverrides {
+			c.HostOverrides[host] = addr
+		}
+	}
+
+	if config.Resolver != nil {
+		c.Resolver = config.Resolver
+	}
+
+	if config.LocalAddr != "" {
+		c.LocalAddr = config.LocalAddr
+	}
+
+	if config.Interface != "" {
+		c.Interface = config.Interface
+	}
+
 	if config.UnixDomainSocket != "" {
 		c.UnixDomainSocket = config.UnixDomainSocket
 	}
@@ -183,10 +413,34 @@ func (c *Config) Merge(config *Config) {
 		c.IsStream = config.IsStream
 	}
 
+	if config.HTTP2 {
+		c.HTTP2 = config.HTTP2
+	}
+
+	if config.H2C != "" {
+		c.H2C = config.H2C
+	}
+
 	if config.BasicAuth.Username != "" || config.BasicAuth.Password != "" {
 		c.BasicAuth = config.BasicAuth
 	}
 
+	if config.DigestAuth != nil {
+		c.DigestAuth = config.DigestAuth
+	}
+
+	if config.OAuth2 != nil {
+		c.OAuth2 = config.OAuth2
+	}
+
+	if config.AWSSigV4 != nil {
+		c.AWSSigV4 = config.AWSSigV4
+	}
+
+	if config.Signer != nil {
+		c.Signer = config.Signer
+	}
+
 	if config.Username != "" || config.Password != "" {
 		c.Username = config.Username
 		c.Password = config.Password
@@ -199,6 +453,86 @@ func (c *Config) Merge(config *Config) {
 	if config.CompressRequest {
 		c.CompressRequest = config.CompressRequest
 	}
+
+	if config.MaxIdleConns != 0 {
+		c.MaxIdleConns = config.MaxIdleConns
+	}
+
+	if config.MaxIdleConnsPerHost != 0 {
+		c.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+
+	if config.MaxConnsPerHost != 0 {
+		c.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+
+	if config.IdleConnTimeout != 0 {
+		c.IdleConnTimeout = config.IdleConnTimeout
+	}
+
+	if config.KeepAlive != 0 {
+		c.KeepAlive = config.KeepAlive
+	}
+
+	if config.DisableKeepAlives {
+		c.DisableKeepAlives = config.DisableKeepAlives
+	}
+
+	if config.RetryPolicy != nil {
+		c.RetryPolicy = config.RetryPolicy
+	}
+
+	if config.FailOnStatus {
+		c.FailOnStatus = config.FailOnStatus
+	}
+
+	if config.FailStatusRanges != nil {
+		c.FailStatusRanges = config.FailStatusRanges
+	}
+
+	if config.ExpectedStatuses != nil {
+		c.ExpectedStatuses = config.ExpectedStatuses
+	}
+
+	if config.CircuitBreaker != nil {
+		c.CircuitBreaker = config.CircuitBreaker
+	}
+
+	if config.RateLimiter != nil {
+		c.RateLimiter = config.RateLimiter
+	}
+
+	if config.Cache != nil {
+		c.Cache = config.Cache
+	}
+
+	if config.IsSession {
+		c.IsSession = config.IsSession
+	}
+
+	if config.CookieJar != nil {
+		c.CookieJar = config.CookieJar
+	}
+
+	if config.RedirectPolicy != nil {
+		c.RedirectPolicy = config.RedirectPolicy
+	}
+
+	if config.SessionStore != nil {
+		c.SessionStore = config.SessionStore
+	}
+
+	if len(config.Middlewares) != 0 {
+		c.Middlewares = append(append([]Middleware{}, c.Middlewares...), config.Middlewares...)
+	}
+
+	if len(config.RequestInterceptors) != 0 {
+		c.RequestInterceptors = append(append([]RequestInterceptor{}, c.RequestInterceptors...), config.RequestInterceptors...)
+	}
+
+	if len(config.ResponseInterceptors) != 0 {
+		c.ResponseInterceptors = append(append([]ResponseInterceptor{}, c.ResponseInterceptors...), config.ResponseInterceptors...)
+	}
 }
 
 // Clone returns a clone of the config
@@ -1,6 +1,9 @@
 package fetch
 
 import (
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/go-zoox/testify"
@@ -97,3 +100,24 @@ func TestConfigParams(t *testing.T) {
 	params.Set("key", "value")
 	testify.Equal(t, params.Get("key"), "value", "Expected value")
 }
+
+func TestConfigMergeValues(t *testing.T) {
+	cfg := Config{
+		HeaderValues: http.Header{"Accept": {"text/html"}},
+	}
+
+	values := url.Values{"id": {"1", "2"}}
+	cfg.Merge(&Config{
+		HeaderValues: http.Header{"Accept": {"application/json"}, "X-Forwarded-For": {"10.0.0.1", "10.0.0.2"}},
+		QueryValues:  values,
+	})
+
+	// the existing keys are not overridden
+	testify.Equal(t, "text/html", strings.Join(cfg.HeaderValues.Values("Accept"), ","))
+	testify.Equal(t, "10.0.0.1,10.0.0.2", strings.Join(cfg.HeaderValues.Values("X-Forwarded-For"), ","))
+	testify.Equal(t, "id=1&id=2", cfg.QueryValues.Encode())
+
+	// the values are copied
+	cfg.QueryValues.Add("id", "3")
+	testify.Equal(t, 2, len(values["id"]))
+}
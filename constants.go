@@ -30,6 +30,16 @@ var METHODS = []string{
 	PATCH,
 }
 
+// H2CPriorKnowledge means speak HTTP/2 over cleartext TCP directly,
+//
+//	the server must be known to support h2c.
+const H2CPriorKnowledge = "prior-knowledge"
+
+// H2CUpgrade means upgrade HTTP/1.1 to h2c with the Upgrade header,
+//
+//	falls back to HTTP/1.1 if the server does not support h2c.
+const H2CUpgrade = "upgrade"
+
 // // headers.ContentType is the content type header name
 // const headers.ContentType = "Content-Type"
 
@@ -128,3 +138,30 @@ var ErrInvalidURLFormEncodedBody = errors.New("invalid url form encoded body")
 
 // ErrCookieEmptyKey is the error when the key is empty
 var ErrCookieEmptyKey = errors.New("empty key")
+
+// ErrH2CUpgradeFailed is the error when the connection cannot be upgraded to h2c
+var ErrH2CUpgradeFailed = errors.New("h2c upgrade failed")
+
+// ErrCircuitOpen is the error when the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrCookieInvalidHost is the error when the cookie host is invalid
+var ErrCookieInvalidHost = errors.New("invalid cookie host")
+
+// ErrSessionLocked is the error when the session file is locked by others too long
+var ErrSessionLocked = errors.New("session file is locked")
+
+// ErrTooManyRedirects is the error when the redirects exceed the max redirects
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// ErrOAuth2TokenFailed is the error when the OAuth2 token cannot be acquired
+var ErrOAuth2TokenFailed = errors.New("failed to acquire oauth2 token")
+
+// ErrUnexpectedStatus is the error when the response status is a failure, see HTTPError
+var ErrUnexpectedStatus = errors.New("unexpected status")
+
+// ErrIdleReadTimeout is the error when no data of the response body arrives within the idle read timeout
+var ErrIdleReadTimeout = errors.New("idle read timeout")
+
+// ErrUnresolvedParam is the error when the param of the url template is not set in the strict mode
+var ErrUnresolvedParam = errors.New("unresolved param")
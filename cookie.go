@@ -36,7 +36,7 @@ func (c *cookie) Parse(str string) (err error) {
 			continue
 		}
 
-		kv := strings.Split(item, "=")
+		kv := strings.SplitN(item, "=", 2)
 		if len(kv) != 2 {
 			continue
 		}
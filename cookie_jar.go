@@ -0,0 +1,462 @@
+package fetch
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookieJar is the RFC 6265 cookie jar,
+//
+//	it is public-suffix aware, scopes cookies by domain and path, and expires them.
+//	it is safe for concurrent use, and can be shared across fetches.
+type CookieJar struct {
+	sync.Mutex
+	entries map[string]*CookieEntry
+	// seq orders the cookies created at the same time
+	seq uint64
+	// version is increased by every change, saved is the version saved to the session store
+	version uint64
+	saved   uint64
+}
+
+// CookieEntry is the stored cookie with its scope
+type CookieEntry struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+	SameSite string    `json:"same_site,omitempty"`
+	// HostOnly means the cookie is only sent to the exact host, no Domain attribute
+	HostOnly bool `json:"host_only,omitempty"`
+	// Persistent means the cookie has Expires or Max-Age, otherwise it is a session cookie
+	Persistent bool      `json:"persistent,omitempty"`
+	Creation   time.Time `json:"creation"`
+
+	seq uint64
+}
+
+// NewCookieJar creates a cookie jar
+func NewCookieJar() *CookieJar {
+	return &CookieJar{
+		entries: make(map[string]*CookieEntry),
+	}
+}
+
+// SetCookieJar sets the cookie jar, which is shared by the clones
+func (f *Fetch) SetCookieJar(jar *CookieJar) *Fetch {
+	f.config.CookieJar = jar
+	return f
+}
+
+// CookieJar returns the cookie jar of fetch, nil if not a session
+func (f *Fetch) CookieJar() *CookieJar {
+	return f.config.CookieJar
+}
+
+func (e *CookieEntry) key() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+func (e *CookieEntry) expired(now time.Time) bool {
+	return e.Persistent && !e.Expires.After(now)
+}
+
+// Cookie returns the entry as http.Cookie
+func (e *CookieEntry) Cookie() *http.Cookie {
+	c := &http.Cookie{
+		Name:     e.Name,
+		Value:    e.Value,
+		Path:     e.Path,
+		Secure:   e.Secure,
+		HttpOnly: e.HttpOnly,
+	}
+
+	if !e.HostOnly {
+		c.Domain = e.Domain
+	}
+
+	if e.Persistent {
+		c.Expires = e.Expires
+	}
+
+	switch strings.ToLower(e.SameSite) {
+	case "lax":
+		c.SameSite = http.SameSiteLaxMode
+	case "strict":
+		c.SameSite = http.SameSiteStrictMode
+	case "none":
+		c.SameSite = http.SameSiteNoneMode
+	}
+
+	return c
+}
+
+// SetCookies implements http.CookieJar, see RFC 6265 section 5.3
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if len(cookies) == 0 || (u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+
+	host, err := canonicalCookieHost(u.Host)
+	if err != nil {
+		return
+	}
+
+	defaultPath := defaultCookiePath(u.Path)
+	now := time.Now()
+
+	j.Lock()
+	defer j.Unlock()
+
+	for _, cookie := range cookies {
+		entry, remove, ok := newCookieEntry(cookie, host, defaultPath, u.Scheme == "https", now)
+		if !ok {
+			continue
+		}
+
+		j.version++
+		if remove {
+			delete(j.entries, entry.key())
+			continue
+		}
+
+		if old, exists := j.entries[entry.key()]; exists {
+			entry.Creation = old.Creation
+			entry.seq = old.seq
+		} else {
+			j.seq++
+			entry.seq = j.seq
+		}
+
+		j.entries[entry.key()] = entry
+	}
+}
+
+// Cookies implements http.CookieJar, returns the cookies to send to the url
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+
+	host, err := canonicalCookieHost(u.Host)
+	if err != nil {
+		return nil
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	now := time.Now()
+
+	j.Lock()
+	defer j.Unlock()
+
+	var selected []*CookieEntry
+	for key, entry := range j.entries {
+		if entry.expired(now) {
+			delete(j.entries, key)
+			continue
+		}
+
+		if !entry.domainMatch(host) || !pathMatch(path, entry.Path) {
+			continue
+		}
+
+		if entry.Secure && u.Scheme != "https" {
+			continue
+		}
+
+		selected = append(selected, entry)
+	}
+
+	// longer paths first, then earlier creation first, see RFC 6265 section 5.4
+	sort.Slice(selected, func(a, b int) bool {
+		if len(selected[a].Path) != len(selected[b].Path) {
+			return len(selected[a].Path) > len(selected[b].Path)
+		}
+
+		if !selected[a].Creation.Equal(selected[b].Creation) {
+			return selected[a].Creation.Before(selected[b].Creation)
+		}
+
+		return selected[a].seq < selected[b].seq
+	})
+
+	cookies := make([]*http.Cookie, 0, len(selected))
+	for _, entry := range selected {
+		cookies = append(cookies, &http.Cookie{Name: entry.Name, Value: entry.Value})
+	}
+
+	return cookies
+}
+
+// Entries returns all the unexpired cookies in the jar
+func (j *CookieJar) Entries() []*CookieEntry {
+	now := time.Now()
+
+	j.Lock()
+	defer j.Unlock()
+
+	entries := make([]*CookieEntry, 0, len(j.entries))
+	for key, entry := range j.entries {
+		if entry.expired(now) {
+			delete(j.entries, key)
+			continue
+		}
+
+		e := *entry
+		entries = append(entries, &e)
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].key() < entries[b].key()
+	})
+
+	return entries
+}
+
+// List returns all the unexpired cookies in the jar as http.Cookie
+func (j *CookieJar) List() []*http.Cookie {
+	entries := j.Entries()
+
+	cookies := make([]*http.Cookie, 0, len(entries))
+	for _, entry := range entries {
+		cookies = append(cookies, entry.Cookie())
+	}
+
+	return cookies
+}
+
+// Add adds the cookie for the url, same rules as received from the url
+func (j *CookieJar) Add(u *url.URL, cookie *http.Cookie) {
+	j.SetCookies(u, []*http.Cookie{cookie})
+}
+
+// AddEntries adds the entries directly, used to restore the jar
+func (j *CookieJar) AddEntries(entries ...*CookieEntry) {
+	now := time.Now()
+
+	j.Lock()
+	defer j.Unlock()
+
+	for _, entry := range entries {
+		if entry.expired(now) {
+			continue
+		}
+
+		e := *entry
+		if e.Creation.IsZero() {
+			e.Creation = now
+		}
+
+		j.seq++
+		e.seq = j.seq
+
+		j.entries[e.key()] = &e
+		j.version++
+	}
+}
+
+// Delete deletes the cookie by domain, path and name
+func (j *CookieJar) Delete(domain, path, name string) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+
+	j.Lock()
+	defer j.Unlock()
+
+	delete(j.entries, domain+";"+path+";"+name)
+	j.version++
+}
+
+// Clear deletes all the cookies
+func (j *CookieJar) Clear() {
+	j.Lock()
+	defer j.Unlock()
+
+	j.entries = make(map[string]*CookieEntry)
+	j.version++
+}
+
+// changed reports whether the jar is changed since saved
+func (j *CookieJar) changed() bool {
+	j.Lock()
+	defer j.Unlock()
+
+	return j.version != j.saved
+}
+
+func (j *CookieJar) currentVersion() uint64 {
+	j.Lock()
+	defer j.Unlock()
+
+	return j.version
+}
+
+// markSaved records the version saved to the session store
+func (j *CookieJar) markSaved(version uint64) {
+	j.Lock()
+	defer j.Unlock()
+
+	if version > j.saved {
+		j.saved = version
+	}
+}
+
+// newCookieEntry creates the entry from the received cookie,
+//
+//	remove means the cookie deletes the stored one, ok is false if the cookie is rejected.
+func newCookieEntry(cookie *http.Cookie, host, defaultPath string, https bool, now time.Time) (entry *CookieEntry, remove bool, ok bool) {
+	if cookie.Name == "" {
+		return nil, false, false
+	}
+
+	// secure cookies can only be set by secure origin
+	if cookie.Secure && !https {
+		return nil, false, false
+	}
+
+	entry = &CookieEntry{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Path:     cookie.Path,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		Creation: now,
+	}
+
+	switch cookie.SameSite {
+	case http.SameSiteLaxMode:
+		entry.SameSite = "Lax"
+	case http.SameSiteStrictMode:
+		entry.SameSite = "Strict"
+	case http.SameSiteNoneMode:
+		entry.SameSite = "None"
+	}
+
+	if entry.Path == "" || entry.Path[0] != '/' {
+		entry.Path = defaultPath
+	}
+
+	domain, hostOnly, ok := cookieDomain(host, cookie.Domain)
+	if !ok {
+		return nil, false, false
+	}
+	entry.Domain = domain
+	entry.HostOnly = hostOnly
+
+	switch {
+	case cookie.MaxAge < 0:
+		return entry, true, true
+	case cookie.MaxAge > 0:
+		entry.Persistent = true
+		entry.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+	case !cookie.Expires.IsZero():
+		entry.Persistent = true
+		entry.Expires = cookie.Expires
+		if !entry.Expires.After(now) {
+			return entry, true, true
+		}
+	}
+
+	return entry, false, true
+}
+
+// cookieDomain returns the domain of the cookie, see RFC 6265 section 5.3 step 4 ~ 6
+func cookieDomain(host, domain string) (string, bool, bool) {
+	if domain == "" {
+		return host, true, true
+	}
+
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	if domain == "" || strings.HasSuffix(domain, ".") {
+		return "", false, false
+	}
+
+	// ip address only accepts exactly the same domain
+	if net.ParseIP(host) != nil {
+		if domain != host {
+			return "", false, false
+		}
+
+		return host, true, true
+	}
+
+	// public suffix, like .com, .co.uk
+	if ps, _ := publicsuffix.PublicSuffix(domain); ps == domain {
+		if host != domain {
+			return "", false, false
+		}
+
+		return host, true, true
+	}
+
+	if host != domain && !strings.HasSuffix(host, "."+domain) {
+		return "", false, false
+	}
+
+	return domain, false, true
+}
+
+func (e *CookieEntry) domainMatch(host string) bool {
+	if e.HostOnly {
+		return host == e.Domain
+	}
+
+	if host == e.Domain {
+		return true
+	}
+
+	return net.ParseIP(host) == nil && strings.HasSuffix(host, "."+e.Domain)
+}
+
+// pathMatch reports whether the request path matches the cookie path, see RFC 6265 section 5.1.4
+func pathMatch(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+// defaultCookiePath returns the default path of cookie, see RFC 6265 section 5.1.4
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+
+	return path[:i]
+}
+
+func canonicalCookieHost(host string) (string, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if host == "" {
+		return "", ErrCookieInvalidHost
+	}
+
+	return strings.ToLower(host), nil
+}
@@ -0,0 +1,114 @@
+package fetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func cookieNames(cookies []*http.Cookie) string {
+	names := []string{}
+	for _, c := range cookies {
+		names = append(names, c.Name+"="+c.Value)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func TestCookieJarDomainAndPath(t *testing.T) {
+	jar := NewCookieJar()
+	jar.SetCookies(mustParseURL(t, "https://www.example.com/account/login"), []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "path", Value: "3", Path: "/account/settings"},
+		{Name: "public", Value: "4", Domain: "com"},
+		{Name: "other", Value: "5", Domain: "other.com"},
+		{Name: "secure", Value: "6", Secure: true, Path: "/"},
+	})
+
+	testify.Equal(t, "host=1, domain=2, secure=6", cookieNames(jar.Cookies(mustParseURL(t, "https://www.example.com/account/"))))
+	testify.Equal(t, "path=3, host=1, domain=2, secure=6", cookieNames(jar.Cookies(mustParseURL(t, "https://www.example.com/account/settings/profile"))))
+	testify.Equal(t, "domain=2", cookieNames(jar.Cookies(mustParseURL(t, "http://api.example.com/"))))
+	testify.Equal(t, "", cookieNames(jar.Cookies(mustParseURL(t, "https://example.org/"))))
+
+	// secure cookies cannot be set over http
+	jar.SetCookies(mustParseURL(t, "http://www.example.com/"), []*http.Cookie{{Name: "insecure", Value: "1", Secure: true}})
+	testify.Equal(t, 4, len(jar.List()))
+}
+
+func TestCookieJarExpiry(t *testing.T) {
+	jar := NewCookieJar()
+	u := mustParseURL(t, "http://example.com/")
+
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "1"},
+		{Name: "max-age", Value: "2", MaxAge: 60},
+		{Name: "expires", Value: "3", Expires: time.Now().Add(time.Hour)},
+		{Name: "expired", Value: "4", Expires: time.Now().Add(-time.Hour)},
+	})
+	testify.Equal(t, 3, len(jar.Cookies(u)))
+
+	// max-age < 0 deletes the cookie
+	jar.SetCookies(u, []*http.Cookie{{Name: "max-age", MaxAge: -1}})
+	testify.Equal(t, "session=1, expires=3", cookieNames(jar.Cookies(u)))
+
+	jar.Delete("example.com", "/", "session")
+	testify.Equal(t, "expires=3", cookieNames(jar.Cookies(u)))
+
+	jar.Add(u, &http.Cookie{Name: "added", Value: "a=b=="})
+	testify.Equal(t, "expires=3, added=a=b==", cookieNames(jar.Cookies(u)))
+
+	jar.Clear()
+	testify.Equal(t, 0, len(jar.List()))
+}
+
+func TestSessionCookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "dG9rZW4=", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "admin", Value: "1", Path: "/admin"})
+		case "/logout":
+			http.SetCookie(w, &http.Cookie{Name: "token", Path: "/", MaxAge: -1})
+		}
+
+		w.Write([]byte(r.Header.Get("Cookie")))
+	}))
+	defer server.Close()
+
+	s := Session()
+	s.SetBaseURL(server.URL)
+
+	if _, err := s.Clone().Get("/login").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// shared across clones
+	response, err := s.Clone().Get("/profile").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "token=dG9rZW4=", response.String())
+
+	response, _ = s.Clone().Get("/admin/users").Execute()
+	testify.Equal(t, "admin=1; token=dG9rZW4=", response.String())
+	testify.Equal(t, 2, len(s.CookieJar().List()))
+
+	s.Clone().Get("/logout").Execute()
+	response, _ = s.Clone().Get("/profile").Execute()
+	testify.Equal(t, "", response.String())
+}
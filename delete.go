@@ -2,5 +2,5 @@ package fetch
 
 // Delete is a wrapper for the Delete method of the Client
 func Delete(url string, config *Config) (*Response, error) {
-	return New().Delete(url, config).Execute()
+	return shared().Delete(url, config).Execute()
 }
@@ -0,0 +1,367 @@
+package fetch
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"github.com/go-zoox/headers"
+)
+
+// DigestAuth is the HTTP Digest authentication (RFC 7616),
+//
+//	it answers the 401 Digest challenge transparently, and reuses the challenge
+//	for the following requests to the same host with nonce counting.
+//	it is safe for concurrent use, and shared by the clones.
+type DigestAuth struct {
+	Username string
+	Password string
+	//
+	sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	// nc is the nonce count of the nonce
+	nc uint32
+}
+
+// digestAlgorithms are the supported algorithms, in the order of preference
+var digestAlgorithms = []string{"SHA-512-256", "SHA-256", "MD5"}
+
+// NewDigestAuth creates a digest auth
+func NewDigestAuth(username, password string) *DigestAuth {
+	return &DigestAuth{
+		Username:   username,
+		Password:   password,
+		challenges: make(map[string]*digestChallenge),
+	}
+}
+
+// SetDigestAuth sets the digest auth username and password
+func (f *Fetch) SetDigestAuth(username, password string) *Fetch {
+	f.config.DigestAuth = NewDigestAuth(username, password)
+	return f
+}
+
+// digestTransport answers the Digest challenge
+type digestTransport struct {
+	auth *DigestAuth
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	authorized := false
+	if authorization, ok, err := t.auth.authorize(host, req); err != nil {
+		return nil, err
+	} else if ok {
+		req = cloneRequestWithHeader(req, headers.Authorization, authorization)
+		authorized = true
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge, ok := parseDigestChallenges(resp.Header.Values(headers.WWWAuthenticate))
+	if !ok {
+		return resp, nil
+	}
+
+	// the credentials are wrong, unless the nonce is stale
+	if authorized && !strings.EqualFold(challenge.stale, "true") {
+		return resp, nil
+	}
+
+	// the body cannot be replayed
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	t.auth.Lock()
+	t.auth.challenges[host] = challenge.digestChallenge
+	t.auth.Unlock()
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+
+	authorization, _, err := t.auth.authorize(host, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.next.RoundTrip(cloneRequestWithHeader(req, headers.Authorization, authorization))
+}
+
+// authorize returns the Authorization header of the request by the cached challenge of the host
+func (a *DigestAuth) authorize(host string, req *http.Request) (string, bool, error) {
+	a.Lock()
+	challenge, ok := a.challenges[host]
+	if !ok {
+		a.Unlock()
+		return "", false, nil
+	}
+	challenge.nc++
+	c := *challenge
+	a.Unlock()
+
+	newHash, ok := digestHash(c.algorithm)
+	if !ok {
+		return "", false, fmt.Errorf("unsupported digest algorithm: %s", c.algorithm)
+	}
+
+	h := func(s string) string {
+		hash := newHash()
+		io.WriteString(hash, s)
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	cnonce, err := newDigestCnonce()
+	if err != nil {
+		return "", false, err
+	}
+
+	nc := fmt.Sprintf("%08x", c.nc)
+	uri := req.URL.RequestURI()
+
+	ha1 := h(a.Username + ":" + c.realm + ":" + a.Password)
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+
+	ha2 := h(req.Method + ":" + uri)
+	if c.qop == "auth-int" {
+		body, err := digestBody(req)
+		if err != nil {
+			return "", false, err
+		}
+
+		ha2 = h(req.Method + ":" + uri + ":" + h(string(body)))
+	}
+
+	var response string
+	if c.qop == "" {
+		// RFC 2069 compatibility
+		response = h(ha1 + ":" + c.nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	}
+
+	params := []string{
+		fmt.Sprintf(`username="%s"`, quoteDigest(a.Username)),
+		fmt.Sprintf(`realm="%s"`, quoteDigest(c.realm)),
+		fmt.Sprintf(`nonce="%s"`, quoteDigest(c.nonce)),
+		fmt.Sprintf(`uri="%s"`, quoteDigest(uri)),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+
+	if c.algorithm != "" {
+		params = append(params, "algorithm="+c.algorithm)
+	}
+
+	if c.opaque != "" {
+		params = append(params, fmt.Sprintf(`opaque="%s"`, quoteDigest(c.opaque)))
+	}
+
+	if c.qop != "" {
+		params = append(params, "qop="+c.qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+
+	return "Digest " + strings.Join(params, ", "), true, nil
+}
+
+type parsedDigestChallenge struct {
+	*digestChallenge
+	stale string
+}
+
+// parseDigestChallenges parses the WWW-Authenticate headers,
+//
+//	returns the Digest challenge of the most preferred supported algorithm.
+func parseDigestChallenges(values []string) (*parsedDigestChallenge, bool) {
+	var best *parsedDigestChallenge
+	bestRank := len(digestAlgorithms)
+
+	for _, value := range values {
+		for _, params := range splitDigestChallenges(value) {
+			algorithm := params["algorithm"]
+			if algorithm == "" {
+				algorithm = "MD5"
+			}
+
+			rank := len(digestAlgorithms)
+			for i, a := range digestAlgorithms {
+				if strings.EqualFold(strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS"), a) {
+					rank = i
+				}
+			}
+
+			if rank >= bestRank {
+				continue
+			}
+
+			qop := ""
+			for _, option := range strings.Split(params["qop"], ",") {
+				option = strings.TrimSpace(option)
+				if option == "auth" || (option == "auth-int" && qop == "") {
+					qop = option
+				}
+			}
+
+			bestRank = rank
+			best = &parsedDigestChallenge{
+				digestChallenge: &digestChallenge{
+					realm:     params["realm"],
+					nonce:     params["nonce"],
+					opaque:    params["opaque"],
+					algorithm: params["algorithm"],
+					qop:       qop,
+				},
+				stale: params["stale"],
+			}
+		}
+	}
+
+	return best, best != nil
+}
+
+// splitDigestChallenges splits the header value into Digest challenges params,
+//
+//	the value may contain several challenges, like: Digest realm="a", nonce="b", Basic realm="c".
+func splitDigestChallenges(value string) []map[string]string {
+	var challenges []map[string]string
+	var current map[string]string
+
+	for value = strings.TrimSpace(value); value != ""; value = strings.TrimLeft(value, ", \t") {
+		// auth scheme, a token without "="
+		token := value
+		if i := strings.IndexAny(value, " \t,="); i != -1 {
+			token = value[:i]
+		}
+
+		rest := strings.TrimLeft(value[len(token):], " \t")
+		if !strings.HasPrefix(rest, "=") {
+			if strings.EqualFold(token, "Digest") {
+				current = map[string]string{}
+				challenges = append(challenges, current)
+			} else {
+				current = nil
+			}
+
+			value = rest
+			continue
+		}
+
+		// auth param
+		rest = strings.TrimLeft(rest[1:], " \t")
+		var paramValue string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+
+			paramValue = b.String()
+			if i < len(rest) {
+				i++
+			}
+			rest = rest[i:]
+		} else {
+			i := strings.IndexAny(rest, ", \t")
+			if i == -1 {
+				i = len(rest)
+			}
+
+			paramValue = rest[:i]
+			rest = rest[i:]
+		}
+
+		if current != nil {
+			current[strings.ToLower(token)] = paramValue
+		}
+
+		value = rest
+	}
+
+	return challenges
+}
+
+func digestHash(algorithm string) (func() hash.Hash, bool) {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New, true
+	case "SHA-256":
+		return sha256.New, true
+	case "SHA-512-256":
+		return sha512.New512_256, true
+	}
+
+	return nil, false
+}
+
+func digestBody(req *http.Request) ([]byte, error) {
+	if req.GetBody == nil {
+		return nil, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+func newDigestCnonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func quoteDigest(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// cloneRequestWithHeader returns a shallow copy of the request with the header set,
+//
+//	the round tripper must not modify the request.
+func cloneRequestWithHeader(req *http.Request, key, value string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set(key, value)
+	return r
+}
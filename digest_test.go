@@ -0,0 +1,153 @@
+package fetch
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-zoox/testify"
+)
+
+type digestServer struct {
+	algorithm string
+	qop       string
+	//
+	sync.Mutex
+	nonce      int
+	staleAfter int
+	ncs        []string
+	challenges int32
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	nonce := fmt.Sprintf("nonce-%d", s.nonce)
+	challenge := func(stale bool) {
+		atomic.AddInt32(&s.challenges, 1)
+		w.Header().Add("WWW-Authenticate", `Basic realm="basic"`)
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="test@example.com", qop="%s", algorithm=%s, nonce="%s", opaque="opaque", stale=%v`, s.qop, s.algorithm, nonce, stale))
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Digest ") {
+		challenge(false)
+		return
+	}
+
+	params := splitDigestChallenges(authorization)[0]
+	if params["nonce"] != nonce {
+		challenge(true)
+		return
+	}
+
+	newHash := md5.New
+	if s.algorithm == "SHA-256" {
+		newHash = sha256.New
+	}
+	h := func(v string) string {
+		var hash hash.Hash = newHash()
+		io.WriteString(hash, v)
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	ha2 := h(r.Method + ":" + params["uri"])
+	if params["qop"] == "auth-int" {
+		body, _ := io.ReadAll(r.Body)
+		ha2 = h(r.Method + ":" + params["uri"] + ":" + h(string(body)))
+	}
+
+	ha1 := h(params["username"] + ":" + params["realm"] + ":secret")
+	expected := h(ha1 + ":" + nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+	if params["response"] != expected || params["opaque"] != "opaque" || params["uri"] != r.URL.RequestURI() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.ncs = append(s.ncs, params["nc"])
+	if s.staleAfter > 0 && len(s.ncs) == s.staleAfter {
+		s.nonce++
+	}
+
+	w.Write([]byte("hello " + params["username"]))
+}
+
+func TestDigestAuth(t *testing.T) {
+	for _, algorithm := range []string{"MD5", "SHA-256"} {
+		server := &digestServer{algorithm: algorithm, qop: "auth"}
+		ts := httptest.NewServer(server)
+
+		f := Create(ts.URL).SetDigestAuth("Mufasa", "secret")
+		for i := 0; i < 3; i++ {
+			response, err := f.Clone().Get("/dir/index.html?a=1").Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+			testify.Equal(t, http.StatusOK, response.Status)
+			testify.Equal(t, "hello Mufasa", response.String())
+		}
+
+		// challenged once, then nonce count increases
+		testify.Equal(t, int32(1), atomic.LoadInt32(&server.challenges))
+		testify.Equal(t, "00000001,00000002,00000003", strings.Join(server.ncs, ","))
+		ts.Close()
+	}
+}
+
+func TestDigestAuthIntAndStale(t *testing.T) {
+	server := &digestServer{algorithm: "MD5", qop: "auth-int", staleAfter: 1}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	f := Create(ts.URL).SetDigestAuth("Mufasa", "secret")
+	for i := 0; i < 2; i++ {
+		response, err := f.Clone().Post("/upload", &Config{Body: map[string]string{"i": fmt.Sprint(i)}}).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, http.StatusOK, response.Status)
+	}
+
+	// the second request is answered with stale nonce, then retried with the new nonce
+	testify.Equal(t, int32(2), atomic.LoadInt32(&server.challenges))
+	testify.Equal(t, "00000001,00000001", strings.Join(server.ncs, ","))
+}
+
+func TestDigestAuthWrongPassword(t *testing.T) {
+	server := &digestServer{algorithm: "MD5", qop: "auth"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	response, err := Create(ts.URL).SetDigestAuth("Mufasa", "wrong").Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusUnauthorized, response.Status)
+}
+
+func TestParseDigestChallenges(t *testing.T) {
+	challenge, ok := parseDigestChallenges([]string{
+		`Digest realm="a, b", qop="auth,auth-int", algorithm=MD5, nonce="n1"`,
+		`Basic realm="basic", Digest realm="a, b", qop="auth-int", algorithm=SHA-256, nonce="n\"2", opaque="o"`,
+	})
+	testify.Assert(t, ok)
+	testify.Equal(t, "SHA-256", challenge.algorithm)
+	testify.Equal(t, "a, b", challenge.realm)
+	testify.Equal(t, `n"2`, challenge.nonce)
+	testify.Equal(t, "o", challenge.opaque)
+	testify.Equal(t, "auth-int", challenge.qop)
+
+	_, ok = parseDigestChallenges([]string{`Basic realm="basic"`})
+	testify.Assert(t, !ok)
+}
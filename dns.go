@@ -0,0 +1,570 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http/httptrace"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"github.com/go-zoox/headers"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver resolves the host to the addresses to dial, *net.Resolver is a Resolver,
+//
+//	the connections are reused by the comparable resolver, like a pointer,
+//	otherwise a new transport is created for each request.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// ResolverFunc is the function adapter of Resolver,
+//
+//	functions are not comparable, so the connections are not reused.
+type ResolverFunc func(ctx context.Context, host string) ([]string, error)
+
+// LookupHost implements Resolver
+func (fn ResolverFunc) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return fn(ctx, host)
+}
+
+// SetHostOverride dials the address instead of the host, like curl --resolve and --connect-to,
+//
+//	host is host:port or host, address is ip, ip:port or host:port.
+func (f *Fetch) SetHostOverride(host, address string) *Fetch {
+	if f.config.HostOverrides == nil {
+		f.config.HostOverrides = make(map[string]string)
+	}
+
+	f.config.HostOverrides[host] = address
+	return f
+}
+
+// SetResolver sets the resolver of the host to dial
+func (f *Fetch) SetResolver(resolver Resolver) *Fetch {
+	f.config.Resolver = comparableResolver(resolver)
+	return f
+}
+
+// SetDNSCache caches the results of the current resolver for the ttl
+func (f *Fetch) SetDNSCache(ttl time.Duration) *Fetch {
+	f.config.Resolver = NewCachedResolver(f.config.Resolver, ttl)
+	return f
+}
+
+// SetLocalAddr sets the local ip to dial from
+func (f *Fetch) SetLocalAddr(ip string) *Fetch {
+	f.config.LocalAddr = ip
+	return f
+}
+
+// SetInterface sets the local network interface to dial from, like eth0
+func (f *Fetch) SetInterface(name string) *Fetch {
+	f.config.Interface = name
+	return f
+}
+
+// NewDNSResolver creates a resolver which queries the DNS server, like 8.8.8.8 or 1.1.1.1:53
+func NewDNSResolver(server string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// CachedResolver caches the resolved addresses for the ttl, the failures are not cached,
+//
+//	the ttl is the cap of the record ttl if the resolver reports it, like DoHResolver.
+type CachedResolver struct {
+	sync.Mutex
+
+	resolver Resolver
+	ttl      time.Duration
+	entries  map[string]*dnsCacheEntry
+}
+
+// ttlResolver is the resolver which reports the minimum ttl of the resolved records
+type ttlResolver interface {
+	lookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error)
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// NewCachedResolver creates a cached resolver, nil resolver means net.DefaultResolver
+func NewCachedResolver(resolver Resolver, ttl time.Duration) *CachedResolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return &CachedResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]*dnsCacheEntry),
+	}
+}
+
+// LookupHost implements Resolver
+func (r *CachedResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.Lock()
+	entry, ok := r.entries[host]
+	r.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	ttl := r.ttl
+	var addrs []string
+	var err error
+	if resolver, ok := r.resolver.(ttlResolver); ok {
+		var recordTTL time.Duration
+		if addrs, recordTTL, err = resolver.lookupHostTTL(ctx, host); err == nil && recordTTL < ttl {
+			ttl = recordTTL
+		}
+	} else {
+		addrs, err = r.resolver.LookupHost(ctx, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.Lock()
+	r.entries[host] = &dnsCacheEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+	r.Unlock()
+
+	return addrs, nil
+}
+
+// Clear removes all the cached addresses
+func (r *CachedResolver) Clear() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.entries = make(map[string]*dnsCacheEntry)
+}
+
+// DoHResolver resolves the host by DNS over HTTPS (RFC 8484)
+type DoHResolver struct {
+	// URL is the DoH endpoint, like https://cloudflare-dns.com/dns-query
+	URL string
+}
+
+// NewDoHResolver creates a DNS over HTTPS resolver
+func NewDoHResolver(url string) *DoHResolver {
+	return &DoHResolver{
+		URL: url,
+	}
+}
+
+// LookupHost implements Resolver, queries both A and AAAA records in parallel,
+//
+//	it fails only if both queries fail.
+func (r *DoHResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, _, err := r.lookupHostTTL(ctx, host)
+	return addrs, err
+}
+
+// lookupHostTTL implements ttlResolver, the ttl is the minimum ttl of the records
+func (r *DoHResolver) lookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error) {
+	qtypes := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	results := make([]dohResult, len(qtypes))
+
+	var wg sync.WaitGroup
+	for i, qtype := range qtypes {
+		wg.Add(1)
+		go func(i int, qtype dnsmessage.Type) {
+			defer wg.Done()
+
+			results[i].addrs, results[i].ttl, results[i].err = r.query(ctx, host, qtype)
+		}(i, qtype)
+	}
+	wg.Wait()
+
+	var addrs []string
+	ttl := time.Duration(math.MaxInt64)
+	var firstErr error
+	for _, result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+
+		if result.ttl < ttl {
+			ttl = result.ttl
+		}
+		addrs = append(addrs, result.addrs...)
+	}
+
+	if len(addrs) == 0 {
+		if firstErr != nil {
+			return nil, 0, firstErr
+		}
+
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: r.URL, IsNotFound: true}
+	}
+
+	return addrs, ttl, nil
+}
+
+type dohResult struct {
+	addrs []string
+	ttl   time.Duration
+	err   error
+}
+
+// query returns the addresses of the qtype records with the minimum ttl of them,
+//
+//	the ttl is math.MaxInt64 if there is no record.
+func (r *DoHResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]string, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+	}
+
+	message := dnsmessage.Message{
+		Header: dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	packed, err := message.Pack()
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+	}
+
+	// the DoH request is sent with the connection settings of the request to resolve,
+	//	except the resolver itself
+	f := New().SetContext(withoutClientTrace(ctx)).inheritTransport(ctx)
+	f.config.Resolver = nil
+
+	response, err := f.Post(r.URL, &Config{
+		Headers: Headers{
+			headers.ContentType: "application/dns-message",
+			headers.Accept:      "application/dns-message",
+		},
+		Body: string(packed),
+	}).Execute()
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+	}
+
+	if !response.Ok() {
+		return nil, 0, &net.DNSError{Err: fmt.Sprintf("unexpected status %d", response.Status), Name: host, Server: r.URL}
+	}
+
+	var parser dnsmessage.Parser
+	header, err := parser.Start(response.Body)
+	if err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+	}
+
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: r.URL, IsNotFound: true}
+	default:
+		return nil, 0, &net.DNSError{Err: header.RCode.String(), Name: host, Server: r.URL}
+	}
+
+	if err := parser.SkipAllQuestions(); err != nil {
+		return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+	}
+
+	var addrs []string
+	ttl := time.Duration(math.MaxInt64)
+	for {
+		answer, err := parser.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+		}
+
+		switch answer.Type {
+		case dnsmessage.TypeA:
+			resource, err := parser.AResource()
+			if err != nil {
+				return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+			}
+
+			addrs = append(addrs, net.IP(resource.A[:]).String())
+			ttl = minTTL(ttl, answer.TTL)
+		case dnsmessage.TypeAAAA:
+			resource, err := parser.AAAAResource()
+			if err != nil {
+				return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+			}
+
+			addrs = append(addrs, net.IP(resource.AAAA[:]).String())
+			ttl = minTTL(ttl, answer.TTL)
+		default:
+			// like CNAME, the addresses of the target are in the answers too
+			if err := parser.SkipAnswer(); err != nil {
+				return nil, 0, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL}
+			}
+		}
+	}
+
+	return addrs, ttl, nil
+}
+
+// minTTL returns the smaller of the current ttl and the record ttl in seconds
+func minTTL(current time.Duration, seconds uint32) time.Duration {
+	if ttl := time.Duration(seconds) * time.Second; ttl < current {
+		return ttl
+	}
+
+	return current
+}
+
+// hostDialer dials with the host overrides, the resolver and the local address,
+//
+//	it dials the proxy instead of the target host if the proxy is used.
+type hostDialer struct {
+	dialer    *net.Dialer
+	overrides map[string]string
+	resolver  Resolver
+	localAddr string
+	iface     string
+}
+
+// Dial implements proxy.Dialer
+func (d *hostDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext dials the overridden address, tries the resolved addresses in order
+func (d *hostDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	addr = d.override(addr)
+
+	if d.resolver == nil && d.localAddr == "" && d.iface == "" {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []string{host}
+	if net.ParseIP(host) == nil {
+		resolver := d.resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+
+		if ips, err = lookupHost(ctx, resolver, host); err != nil {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) {
+				err = &net.DNSError{Err: err.Error(), Name: host}
+			}
+
+			return nil, err
+		}
+	}
+
+	var firstErr error
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || !matchNetwork(network, parsed) {
+			continue
+		}
+
+		dialer := *d.dialer
+		if dialer.LocalAddr, err = d.local(parsed); err != nil {
+			return nil, err
+		}
+
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = &net.DNSError{Err: "no suitable address", Name: host}
+	}
+
+	return nil, firstErr
+}
+
+// lookupHost resolves the host, traced as the dns lookup of the request,
+//
+//	*net.Resolver traces itself, while the other resolvers cannot see the client trace,
+//	like DoHResolver which sends its own request.
+func lookupHost(ctx context.Context, resolver Resolver, host string) ([]string, error) {
+	if _, ok := resolver.(*net.Resolver); ok {
+		return resolver.LookupHost(ctx, host)
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+
+	addrs, err := resolver.LookupHost(withoutClientTrace(ctx), host)
+
+	if trace != nil && trace.DNSDone != nil {
+		info := httptrace.DNSDoneInfo{Err: err}
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil {
+				info.Addrs = append(info.Addrs, net.IPAddr{IP: ip})
+			}
+		}
+		trace.DNSDone(info)
+	}
+
+	return addrs, err
+}
+
+// traceFreeContext hides the client traces (of net/http/httptrace and net) of the parent,
+//
+//	while the cancellation and the other values are kept.
+type traceFreeContext struct {
+	context.Context
+}
+
+func withoutClientTrace(ctx context.Context) context.Context {
+	return traceFreeContext{Context: ctx}
+}
+
+func (c traceFreeContext) Value(key interface{}) interface{} {
+	if t := reflect.TypeOf(key); t != nil {
+		if path := t.PkgPath(); path == "net/http/httptrace" || path == "internal/nettrace" {
+			return nil
+		}
+	}
+
+	return c.Context.Value(key)
+}
+
+// override returns the overridden address of host:port or host
+func (d *hostDialer) override(addr string) string {
+	if value, ok := d.overrides[addr]; ok {
+		return withPort(value, addr)
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	if value, ok := d.overrides[host]; ok {
+		return withPort(value, addr)
+	}
+
+	return addr
+}
+
+// local returns the local address to dial the ip from
+func (d *hostDialer) local(ip net.IP) (net.Addr, error) {
+	if d.localAddr != "" {
+		local := net.ParseIP(d.localAddr)
+		if local == nil {
+			return nil, fmt.Errorf("invalid local address: %s", d.localAddr)
+		}
+
+		return &net.TCPAddr{IP: local}, nil
+	}
+
+	if d.iface == "" {
+		return nil, nil
+	}
+
+	iface, err := net.InterfaceByName(d.iface)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interface %s: %w", d.iface, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get addresses of interface %s: %w", d.iface, err)
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && (ipNet.IP.To4() != nil) == (ip.To4() != nil) {
+			return &net.TCPAddr{IP: ipNet.IP}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("interface %s has no address to dial %s", d.iface, ip)
+}
+
+// withPort appends the port of addr to value if value has no port
+func withPort(value, addr string) string {
+	if _, _, err := net.SplitHostPort(value); err == nil {
+		return value
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return value
+	}
+
+	return net.JoinHostPort(strings.Trim(value, "[]"), port)
+}
+
+func matchNetwork(network string, ip net.IP) bool {
+	switch network {
+	case "tcp4", "udp4":
+		return ip.To4() != nil
+	case "tcp6", "udp6":
+		return ip.To4() == nil
+	}
+
+	return true
+}
+
+// hostOverridesKey serializes the host overrides for the transport key
+func hostOverridesKey(overrides map[string]string) string {
+	pairs := make([]string, 0, len(overrides))
+	for host, addr := range overrides {
+		pairs = append(pairs, host+"="+addr)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func parseHostOverridesKey(key string) map[string]string {
+	if key == "" {
+		return nil
+	}
+
+	overrides := make(map[string]string)
+	for _, pair := range strings.Split(key, ",") {
+		if host, addr, ok := strings.Cut(pair, "="); ok {
+			overrides[host] = addr
+		}
+	}
+
+	return overrides
+}
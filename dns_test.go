@@ -0,0 +1,315 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func newHostServer() (*httptest.Server, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		w.Write([]byte(r.Host + "|" + host))
+	}))
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	return server, port
+}
+
+type countingResolver struct {
+	lookups int32
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	if host == "api.internal" {
+		return []string{"127.0.0.1"}, nil
+	}
+
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestHostOverrides(t *testing.T) {
+	server, port := newHostServer()
+	defer server.Close()
+
+	// like curl --resolve
+	response, err := New().
+		SetHostOverride("example.test:"+port, "127.0.0.1").
+		Get("http://example.test:" + port + "/").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "example.test:"+port+"|127.0.0.1", response.String())
+
+	// like curl --connect-to
+	response, err = Get("http://example.test/", &Config{
+		HostOverrides: map[string]string{"example.test": "127.0.0.1:" + port},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "example.test|127.0.0.1", response.String())
+}
+
+func TestHostOverridesKeepSNI(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.ServerName))
+	}))
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	// the certificate of httptest is for example.com
+	response, err := Get("https://example.com:"+port+"/", &Config{
+		TLSCaCert:     ca,
+		HostOverrides: map[string]string{"example.com": "127.0.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "example.com", response.String())
+}
+
+func TestResolverWithCache(t *testing.T) {
+	server, port := newHostServer()
+	defer server.Close()
+
+	resolver := &countingResolver{}
+	f := New().SetResolver(resolver).SetDNSCache(time.Minute).SetConfig(&Config{DisableKeepAlives: true})
+
+	for i := 0; i < 3; i++ {
+		response, err := f.Clone().Get("http://api.internal:" + port + "/").Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, "api.internal:"+port+"|127.0.0.1", response.String())
+	}
+	testify.Equal(t, int32(1), atomic.LoadInt32(&resolver.lookups))
+
+	_, err := f.Clone().Get("http://missing.internal:" + port + "/").Execute()
+	testify.Assert(t, IsDNSError(err), "expected dns error")
+}
+
+func TestResolverFunc(t *testing.T) {
+	server, port := newHostServer()
+	defer server.Close()
+
+	response, err := New().
+		SetResolver(ResolverFunc(func(ctx context.Context, host string) ([]string, error) {
+			return []string{"127.0.0.1"}, nil
+		})).
+		Get("http://func.internal:" + port + "/").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "func.internal:"+port+"|127.0.0.1", response.String())
+}
+
+// newDoHHandler is the stand-in of DNS over HTTPS server, doh.test is 127.0.0.1
+func newDoHHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		var query dnsmessage.Message
+		if err := query.Unpack(body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		question := query.Questions[0]
+		answer := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+			Questions: query.Questions,
+		}
+
+		switch {
+		case question.Name.String() != "doh.test.":
+			answer.RCode = dnsmessage.RCodeNameError
+		case question.Type == dnsmessage.TypeA:
+			answer.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			}}
+		}
+
+		packed, _ := answer.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	})
+}
+
+func TestDoHResolver(t *testing.T) {
+	server, port := newHostServer()
+	defer server.Close()
+
+	doh := httptest.NewServer(newDoHHandler())
+	defer doh.Close()
+
+	resolver := NewDoHResolver(doh.URL + "/dns-query")
+
+	addrs, err := resolver.LookupHost(context.Background(), "doh.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, 1, len(addrs))
+	testify.Equal(t, "127.0.0.1", addrs[0])
+
+	response, err := New().SetResolver(resolver).Get("http://doh.test:" + port + "/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "doh.test:"+port+"|127.0.0.1", response.String())
+
+	_, err = New().SetResolver(resolver).Get("http://unknown.test:" + port + "/").Execute()
+	testify.Assert(t, IsDNSError(err), "expected dns error")
+}
+
+func TestDoHResolverParallel(t *testing.T) {
+	var inflight, peak int32
+	handler := newDoHHandler()
+
+	// the AAAA query fails, the A query still resolves the host
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			value := atomic.LoadInt32(&peak)
+			if current <= value || atomic.CompareAndSwapInt32(&peak, value, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		body, _ := io.ReadAll(r.Body)
+		var query dnsmessage.Message
+		if err := query.Unpack(body); err == nil && query.Questions[0].Type == dnsmessage.TypeAAAA {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	}))
+	defer doh.Close()
+
+	resolver := NewDoHResolver(doh.URL + "/dns-query")
+
+	addrs, err := resolver.LookupHost(context.Background(), "doh.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, 1, len(addrs))
+	testify.Equal(t, "127.0.0.1", addrs[0])
+	testify.Equal(t, int32(2), atomic.LoadInt32(&peak))
+
+	_, err = resolver.LookupHost(context.Background(), "unknown.test")
+	testify.Assert(t, IsDNSError(err), "expected dns error")
+}
+
+func TestDoHResolverWithCacheTTL(t *testing.T) {
+	doh := httptest.NewServer(newDoHHandler())
+	defer doh.Close()
+
+	// the record ttl is 60s
+	for _, c := range []struct {
+		cap time.Duration
+		ttl time.Duration
+	}{
+		{cap: time.Hour, ttl: 60 * time.Second},
+		{cap: 10 * time.Second, ttl: 10 * time.Second},
+	} {
+		resolver := NewCachedResolver(NewDoHResolver(doh.URL+"/dns-query"), c.cap)
+
+		start := time.Now()
+		if _, err := resolver.LookupHost(context.Background(), "doh.test"); err != nil {
+			t.Fatal(err)
+		}
+
+		expires := resolver.entries["doh.test"].expires
+		testify.Assert(t, !expires.Before(start.Add(c.ttl)), "expected the entry to live for the ttl")
+		testify.Assert(t, !expires.After(time.Now().Add(c.ttl)), "expected the entry to expire after the ttl")
+	}
+}
+
+func TestDoHResolverTLS(t *testing.T) {
+	server, port := newHostServer()
+	defer server.Close()
+
+	doh := httptest.NewTLSServer(newDoHHandler())
+	defer doh.Close()
+
+	// the DoH request trusts the ca of the request to resolve
+	response, err := New().
+		SetResolver(NewDoHResolver(doh.URL+"/dns-query")).
+		Get("http://doh.test:"+port+"/", &Config{
+			TLSCaCert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: doh.Certificate().Raw}),
+		}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "doh.test:"+port+"|127.0.0.1", response.String())
+}
+
+func TestLocalAddr(t *testing.T) {
+	server, port := newHostServer()
+	defer server.Close()
+
+	response, err := New().SetLocalAddr("127.0.0.1").Get("http://localhost:" + port + "/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "localhost:"+port+"|127.0.0.1", response.String())
+
+	_, err = New().SetLocalAddr("invalid").Get("http://localhost:" + port + "/").Execute()
+	testify.Assert(t, err != nil, "expected invalid local address")
+
+	_, err = New().SetInterface("not-exist0").Get("http://127.0.0.1:" + port + "/").Execute()
+	testify.Assert(t, err != nil, "expected invalid interface")
+}
+
+func TestDoHResolverTrace(t *testing.T) {
+	server, port := newHostServer()
+	defer server.Close()
+
+	// the slow DoH server
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		newDoHHandler().ServeHTTP(w, r)
+	}))
+	defer doh.Close()
+
+	response, err := New().
+		SetResolver(NewDoHResolver(doh.URL + "/dns-query")).
+		SetTrace(true).
+		Get("http://doh.test:" + port + "/").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "doh.test:"+port+"|127.0.0.1", response.String())
+
+	// the DoH request is the dns lookup of the request, not traced as its connection
+	timing := response.Timing
+	testify.Assert(t, timing.DNSLookup >= 20*time.Millisecond, "expected the dns lookup of DoH")
+	testify.Assert(t, timing.TCPConnect > 0, "expected tcp connect")
+	testify.Assert(t, timing.TimeToFirstByte >= timing.DNSLookup, "expected time to first byte")
+	testify.Equal(t, server.Listener.Addr().String(), timing.RemoteAddr)
+}
@@ -9,5 +9,5 @@ func Download(url string, filepath string, config ...interface{}) (*Response, er
 		return nil, ErrTooManyArguments
 	}
 
-	return New().Download(url, filepath, c).Execute()
+	return shared().Download(url, filepath, c).Execute()
 }
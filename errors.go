@@ -0,0 +1,106 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Error is the error of Execute, which wraps the sentinel error and the cause,
+//
+//	so that both errors.Is(err, ErrSendingRequest) and errors.As(err, &netErr) work.
+type Error struct {
+	// Sentinel is the exported error of the step, like ErrSendingRequest
+	Sentinel error
+	// Err is the cause
+	Err error
+
+	message string
+}
+
+// newError creates an Error, the message is the legacy one like ErrSendingRequest(3): ...
+func newError(sentinel error, message string, err error) *Error {
+	return &Error{
+		Sentinel: sentinel,
+		Err:      err,
+		message:  message,
+	}
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Is reports whether the target is the sentinel error
+func (e *Error) Is(target error) bool {
+	return target == e.Sentinel
+}
+
+// Unwrap returns the cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsTimeout reports whether the error is caused by a timeout,
+//
+//	like the client timeout, the context deadline, a dial / read timeout or the idle read timeout.
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, ErrIdleReadTimeout) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsDNSError reports whether the error is caused by the DNS lookup
+func IsDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// IsTLSError reports whether the error is caused by the TLS handshake or certificate verification
+func IsTLSError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var recordErr tls.RecordHeaderError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &recordErr) ||
+		errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &certificateInvalidErr) ||
+		errors.As(err, &hostnameErr) {
+		return true
+	}
+
+	// the alerts and handshake failures are not exported by crypto/tls
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// IsConnectionRefused reports whether the connection is refused by the server
+func IsConnectionRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// AsHTTPError returns the *HTTPError in the error chain
+func AsHTTPError(err error) (*HTTPError, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr, true
+	}
+
+	return nil, false
+}
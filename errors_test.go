@@ -0,0 +1,129 @@
+package fetch
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func TestErrorSendingRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	_, err := Get(server.URL)
+	testify.Assert(t, errors.Is(err, ErrSendingRequest), "expected ErrSendingRequest")
+	testify.Assert(t, IsConnectionRefused(err), "expected connection refused")
+	testify.Assert(t, !IsTimeout(err), "unexpected timeout")
+
+	var opErr *net.OpError
+	testify.Assert(t, errors.As(err, &opErr), "expected *net.OpError")
+}
+
+func TestErrorTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	_, err := Get(server.URL, &Config{Timeout: 20 * time.Millisecond})
+	testify.Assert(t, errors.Is(err, ErrSendingRequest), "expected ErrSendingRequest")
+	testify.Assert(t, IsTimeout(err), "expected timeout")
+}
+
+func TestErrorTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := Get(server.URL)
+	testify.Assert(t, IsTLSError(err), "expected tls error")
+	testify.Assert(t, !IsDNSError(err), "unexpected dns error")
+}
+
+func TestErrorDNS(t *testing.T) {
+	err := newError(ErrSendingRequest, "ErrSendingRequest(3)", &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true})
+	testify.Assert(t, IsDNSError(err), "expected dns error")
+	testify.Assert(t, errors.Is(err, ErrSendingRequest), "expected ErrSendingRequest")
+	testify.Assert(t, !errors.Is(err, ErrReadingResponse), "unexpected ErrReadingResponse")
+}
+
+func TestErrorTooManyRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := Create(server.URL).SetMaxRedirects(2).Get("/").Execute()
+	testify.Assert(t, errors.Is(err, ErrTooManyRedirects), "expected ErrTooManyRedirects")
+	testify.Assert(t, errors.Is(err, ErrSendingRequest), "expected ErrSendingRequest")
+}
+
+func TestErrorWrapped(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	missing := filepath.Join(t.TempDir(), "missing", "file.txt")
+	_, err := Post(server.URL, &Config{
+		Headers: Headers{"Content-Type": "multipart/form-data"},
+		Body:    NewMultipartBody().AddFileFromPath("file", missing),
+	})
+	testify.Assert(t, errors.Is(err, ErrInvalidBodyMultipart), "expected ErrInvalidBodyMultipart")
+	testify.Assert(t, errors.Is(err, os.ErrNotExist), "expected os.ErrNotExist")
+
+	_, err = Get(server.URL, &Config{DownloadFilePath: missing})
+	testify.Assert(t, errors.Is(err, ErrReadingResponse), "expected ErrReadingResponse")
+	testify.Assert(t, errors.Is(err, os.ErrNotExist), "expected os.ErrNotExist")
+}
+
+func TestHTTPErrorProblem(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{
+			"type": "https://example.com/probs/out-of-credit",
+			"title": "You do not have enough credit.",
+			"status": 403,
+			"detail": "Your current balance is 30, but that costs 50.",
+			"instance": "/account/12345/msgs/abc",
+			"balance": 30
+		}`))
+	}))
+	defer server.Close()
+
+	response, err := Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpErr, ok := AsHTTPError(response.Error())
+	testify.Assert(t, ok, "expected *HTTPError")
+	testify.Equal(t, http.StatusForbidden, httpErr.Status)
+	testify.Equal(t, "application/problem+json", httpErr.Headers.Get("Content-Type"))
+	testify.Assert(t, httpErr.Request != nil, "expected request config")
+	testify.Assert(t, httpErr.Problem != nil, "expected problem")
+	testify.Equal(t, "https://example.com/probs/out-of-credit", httpErr.Problem.Type)
+	testify.Equal(t, 403, httpErr.Problem.Status)
+	testify.Equal(t, "/account/12345/msgs/abc", httpErr.Problem.Instance)
+	testify.Assert(t, httpErr.Problem.Extensions["balance"] == float64(30), "expected balance extension")
+	testify.Equal(t, "[403] You do not have enough credit.: Your current balance is 30, but that costs 50.", httpErr.Error())
+}
+
+func TestParseProblemIgnoresInvalidMembers(t *testing.T) {
+	problem, err := ParseProblem([]byte(`{"title": 1, "status": 500}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "", problem.Title)
+	testify.Equal(t, 500, problem.Status)
+
+	_, err = ParseProblem([]byte(`not json`))
+	testify.Assert(t, err != nil, "expected error")
+}
@@ -3,17 +3,11 @@ package fetch
 import (
 	"bytes"
 	"compress/gzip"
-	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
-	"errors"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
-	"net"
 	"net/http"
-	"net/textproto"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"strconv"
@@ -23,8 +17,6 @@ import (
 	"github.com/go-zoox/core-utils/fmt"
 	"github.com/go-zoox/headers"
 	"github.com/tidwall/gjson"
-
-	"golang.org/x/net/proxy"
 )
 
 // Execute executes the request
@@ -35,7 +27,7 @@ func (f *Fetch) Execute() (*Response, error) {
 
 	config, err := f.Config()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get config: %v", err)
+		return nil, fmt.Errorf("failed to get config: %w", err)
 	}
 
 	if os.Getenv(EnvDEBUG) != "" {
@@ -46,21 +38,11 @@ func (f *Fetch) Execute() (*Response, error) {
 
 	fullURL := config.URL
 	methodOrigin := config.Method
-	// @ORIGIN QUERY
-	var urlQueryOrigin url.Values
-	if strings.ContainsAny(fullURL, "?") {
-		u, err := url.Parse(config.BaseURL)
-		if err != nil {
-			return nil, errors.New("failed to parsed origin url")
-		}
-
-		urlQueryOrigin = u.Query()
-	}
 
 	if config.TLSCaCertFile != "" {
 		caCrt, err := ioutil.ReadFile(config.TLSCaCertFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read tls certificate file(%s): %v", config.TLSCaCertFile, err)
+			return nil, fmt.Errorf("failed to read tls certificate file(%s): %w", config.TLSCaCertFile, err)
 		}
 
 		config.TLSCaCert = caCrt
@@ -69,7 +51,7 @@ func (f *Fetch) Execute() (*Response, error) {
 	if config.TLSCertFile != "" {
 		clientCrt, err := ioutil.ReadFile(config.TLSCertFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read tls certificate file(%s): %v", config.TLSCertFile, err)
+			return nil, fmt.Errorf("failed to read tls certificate file(%s): %w", config.TLSCertFile, err)
 		}
 
 		config.TLSCert = clientCrt
@@ -78,126 +60,85 @@ func (f *Fetch) Execute() (*Response, error) {
 	if config.TLSKeyFile != "" {
 		clientKey, err := ioutil.ReadFile(config.TLSKeyFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read tls certificate file(%s): %v", config.TLSKeyFile, err)
+			return nil, fmt.Errorf("failed to read tls certificate file(%s): %w", config.TLSKeyFile, err)
 		}
 
 		config.TLSKey = clientKey
 	}
 
-	transport := http.DefaultTransport
-	if config.TLSCaCert != nil {
-		pool := x509.NewCertPool()
-		pool.AppendCertsFromPEM(config.TLSCaCert)
-
-		// defaultTransportDialContext := func(dialer *net.Dialer) func(context.Context, string, string) (net.Conn, error) {
-		// 	return dialer.DialContext
-		// }
-
-		// transport = &http.Transport{
-		// 	Proxy: http.ProxyFromEnvironment,
-		// 	DialContext: defaultTransportDialContext(&net.Dialer{
-		// 		Timeout:   30 * time.Second,
-		// 		KeepAlive: 30 * time.Second,
-		// 	}),
-		// 	ForceAttemptHTTP2:     true,
-		// 	MaxIdleConns:          100,
-		// 	IdleConnTimeout:       90 * time.Second,
-		// 	TLSHandshakeTimeout:   10 * time.Second,
-		// 	ExpectContinueTimeout: 1 * time.Second,
-		// 	// https://stackoverflow.com/questions/38822764/how-to-send-a-https-request-with-a-certificate-golang
-		// 	TLSClientConfig: &tls.Config{
-		// 		RootCAs: pool,
-		// 	},
-		// }
-
-		tr := transport.(*http.Transport)
-		if tr.TLSClientConfig == nil {
-			tr.TLSClientConfig = &tls.Config{}
-		}
-		tr.TLSClientConfig.RootCAs = pool
+	transport, err := f.transports.Get(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport: %w", err)
 	}
 
-	if config.TLSCert != nil && config.TLSKey != nil {
-		tr := transport.(*http.Transport)
-		if tr.TLSClientConfig == nil {
-			tr.TLSClientConfig = &tls.Config{}
-		}
+	var roundTripper http.RoundTripper = transport
+	if len(config.ProxyHeaders) != 0 {
+		roundTripper = &proxyHeaderTransport{next: roundTripper}
+	}
 
-		clientCrt, err := tls.X509KeyPair(config.TLSCert, config.TLSKey)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load client cert and key: %v", err)
-		}
+	if config.DigestAuth != nil {
+		roundTripper = &digestTransport{auth: config.DigestAuth, next: roundTripper}
+	}
 
-		tr.TLSClientConfig.Certificates = []tls.Certificate{clientCrt}
+	if config.AWSSigV4 != nil {
+		roundTripper = &signerTransport{signer: config.AWSSigV4, next: roundTripper}
 	}
 
-	if config.TLSInsecureSkipVerify {
-		tr := transport.(*http.Transport)
-		if tr.TLSClientConfig == nil {
-			tr.TLSClientConfig = &tls.Config{}
+	if config.Signer != nil {
+		roundTripper = &signerTransport{signer: config.Signer, next: roundTripper}
+	}
+
+	if config.OAuth2 != nil {
+		roundTripper = &oauth2Transport{
+			source:               config.OAuth2,
+			next:                 roundTripper,
+			forwardAuthorization: config.RedirectPolicy != nil && config.RedirectPolicy.ForwardAuthorization,
 		}
-		tr.TLSClientConfig.InsecureSkipVerify = config.TLSInsecureSkipVerify
 	}
 
-	// if f.config.HTTP2 {
-	// 	if err := http2.ConfigureTransport(&transport); err != nil {
-	// 		return nil, fmt.Errorf("failed to configure http2: %v", err)
-	// 	}
-	// }
+	if config.RateLimiter != nil {
+		roundTripper = &rateLimitTransport{limiter: config.RateLimiter, next: roundTripper}
+	}
+
+	roundTripper = newRetrier(config.RetryPolicy, roundTripper)
+
+	var cacher *cacher
+	if config.Cache != nil {
+		cacher = newCacher(config.Cache, roundTripper)
+		roundTripper = cacher
+	}
+
+	// the middlewares wrap the whole exchange, like the cache, retries and auth
+	roundTripper = applyMiddlewares(config, roundTripper)
+
+	if config.IsSession && config.CookieJar == nil {
+		config.CookieJar = NewCookieJar()
+		f.config.CookieJar = config.CookieJar
+	}
 
 	client := &http.Client{
 		Timeout:   config.Timeout,
-		Transport: transport,
+		Transport: roundTripper,
 	}
 
-	// apply proxy
-	if config.Proxy != "" {
-		// fmt.Println("proxy:", config.Proxy)
-		proxyURL, err := url.Parse(config.Proxy)
-		if err != nil {
-			return nil, fmt.Errorf("invalid proxy: %s", config.Proxy)
-		}
+	if config.CookieJar != nil {
+		client.Jar = config.CookieJar
+	}
 
-		switch proxyURL.Scheme {
-		case "http", "https":
-			client.Transport = &http.Transport{
-				Proxy: http.ProxyURL(proxyURL),
-				Dial: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).Dial,
-				// default transport
-				ForceAttemptHTTP2:     true,
-				MaxIdleConns:          100,
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-			}
-		case "socks5", "socks5h":
-			dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
-			if err != nil {
-				return nil, fmt.Errorf("invalid socks5 proxy: %s", config.Proxy)
-			}
+	attempts := 0
+	ctx := withProxySelector(withAttempts(f.config.Context, &attempts), config)
+	ctx = withParentTransport(ctx, config, f.transports)
 
-			client.Transport = &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				Dial:  dialer.Dial,
-				// default transport
-				ForceAttemptHTTP2:     true,
-				MaxIdleConns:          100,
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-			}
-		default:
-			return nil, fmt.Errorf("unsupport proxy(%s)", config.Proxy)
-		}
+	var tracer *timingTracer
+	if config.Trace {
+		tracer = &timingTracer{}
+		ctx = httptrace.WithClientTrace(ctx, tracer.trace())
 	}
 
-	req, err := http.NewRequestWithContext(f.config.Context, methodOrigin, fullURL, nil)
+	req, err := http.NewRequestWithContext(ctx, methodOrigin, fullURL, nil)
 	if err != nil {
 		// panic("error creating request: " + err.Error())
-		return nil, errors.New("ErrCannotCreateRequest(1): " + ErrCannotCreateRequest.Error() + ", err: " + err.Error())
+		return nil, newError(ErrCannotCreateRequest, "ErrCannotCreateRequest(1): "+ErrCannotCreateRequest.Error()+", err: "+err.Error(), err)
 	}
 
 	// @TODO
@@ -211,18 +152,18 @@ func (f *Fetch) Execute() (*Response, error) {
 			req.Header.Set(k, v)
 		}
 	}
+	for k, values := range config.HeaderValues {
+		for _, v := range values {
+			if v != "" {
+				req.Header.Add(k, v)
+			}
+		}
+	}
 
+	// the origin query (of url and base url) is kept with all the values
 	query := req.URL.Query()
-	// apply origin query
-	for k, v := range urlQueryOrigin {
-		query.Add(k, v[0])
-	}
-	// apply custom query
-	for k, v := range config.Query {
-		// ignore empty value
-		if v != "" {
-			query.Add(k, v)
-		}
+	if err := addConfigQuery(query, config); err != nil {
+		return nil, err
 	}
 	req.URL.RawQuery = query.Encode()
 	if config.Username != "" || config.Password != "" {
@@ -238,97 +179,100 @@ func (f *Fetch) Execute() (*Response, error) {
 
 	if config.Body != nil {
 		if req.Header.Get(headers.ContentType) == "" {
-			req.Header.Set(headers.ContentType, "application/json")
+			if _, ok := config.Body.(*MultipartBody); ok {
+				req.Header.Set(headers.ContentType, "multipart/form-data")
+			} else {
+				req.Header.Set(headers.ContentType, "application/json")
+			}
 		}
 
 		if strings.Contains(req.Header.Get(headers.ContentType), "application/json") {
 			body, err := json.Marshal(config.Body)
 			if err != nil {
 				// panic("error marshalling body: " + err.Error())
-				return nil, errors.New("ErrInvalidJSONBody(2): " + ErrInvalidJSONBody.Error() + ", err: " + err.Error())
+				return nil, newError(ErrInvalidJSONBody, "ErrInvalidJSONBody(2): "+ErrInvalidJSONBody.Error()+", err: "+err.Error(), err)
 			}
 
 			// req.Header.Set(HeaderContentTye, "application/json")
 			req.Body = ioutil.NopCloser(bytes.NewReader(body))
 		} else if strings.Contains(req.Header.Get(headers.ContentType), "application/x-www-form-urlencoded") {
-			body := url.Values{}
-			if kv, ok := config.Body.(map[string]string); ok {
-				for k, v := range kv {
-					body.Add(k, v)
-				}
-			} else {
-				return nil, errors.New(ErrInvalidURLFormEncodedBody.Error() + ": must be map[string]string")
+			// the form tag is preferred, like `form:"name,omitempty"`
+			body, err := encodeValues(config.Body, config.ArrayFormat, "form", "query")
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidURLFormEncodedBody, err)
 			}
 
 			// req.Header.Set(HeaderContentTye, "application/x-www-form-urlencoded")
 			// req.Body = ioutil.NopCloser(bytes.NewReader(body))
 			req.Body = ioutil.NopCloser(strings.NewReader(body.Encode()))
 		} else if strings.Contains(req.Header.Get(headers.ContentType), "multipart/form-data") {
-			if values, ok := config.Body.(map[string]interface{}); ok {
-				var b bytes.Buffer
-				w := multipart.NewWriter(&b)
-				for k, v := range values {
-					if v == nil {
-						continue
-					}
-
-					var fw io.Writer
-					if text, ok := v.(string); ok {
-						if fw, err = w.CreateFormField(k); err != nil {
-							return nil, err
-						}
-
-						if _, err = io.Copy(fw, strings.NewReader(text)); err != nil {
-							return nil, err
-						}
+			var source *MultipartBody
+			switch v := config.Body.(type) {
+			case *MultipartBody:
+				source = v
+			case map[string]interface{}:
+				source = multipartBodyOf(v)
+			case map[string]string:
+				values := make(map[string]interface{}, len(v))
+				for k, text := range v {
+					values[k] = text
+				}
+				source = multipartBodyOf(values)
+			default:
+				return nil, fmt.Errorf("%w: must be *MultipartBody, map[string]interface{} or map[string]string", ErrInvalidBodyMultipart)
+			}
 
-						continue
-					}
+			parts, err := source.build()
+			if err != nil {
+				return nil, multipartError(err)
+			}
 
-					if f, ok := v.(io.ReadCloser); ok {
-						// fix multipart form file content type
-						if err := createFormFile(w, f, k); err != nil {
-							return nil, err
-						}
+			body := newMultipartBody(parts)
 
-						continue
-					}
-				}
-				w.Close()
-				req.Header.Set(headers.ContentType, w.FormDataContentType())
-				req.Body = ioutil.NopCloser(&b)
-			} else if values, ok := config.Body.(map[string]string); ok {
-				var b bytes.Buffer
-				w := multipart.NewWriter(&b)
-				for k, v := range values {
-					var fw io.Writer
-					if fw, err = w.CreateFormField(k); err != nil {
-						return nil, err
-					}
+			req.Header.Set(headers.ContentType, body.ContentType())
+			req.Body = body
+			if length := body.ContentLength(); length >= 0 {
+				req.ContentLength = length
+			}
 
-					if _, err = io.Copy(fw, strings.NewReader(v)); err != nil {
-						return nil, err
+			// the streaming body is replayed by building the parts again, never buffered,
+			//	so the body of readers cannot be replayed, and the retries are skipped
+			if source.replayable() {
+				req.GetBody = func() (io.ReadCloser, error) {
+					parts, err := source.build()
+					if err != nil {
+						return nil, multipartError(err)
 					}
 
-					continue
+					return body.replay(parts), nil
 				}
-				w.Close()
-				req.Header.Set(headers.ContentType, w.FormDataContentType())
-				req.Body = ioutil.NopCloser(&b)
-			} else {
-				return nil, errors.New(ErrInvalidBodyMultipart.Error() + ": must be map[string]interface{} or map[string]string")
 			}
 		} else if strings.Contains(req.Header.Get(headers.ContentType), "application/octet-stream") {
 			if config.Body == nil {
-				return nil, fmt.Errorf("octet-stream body is required")
+				return nil, fmt.Errorf("%w: octet-stream body is required", ErrorInvalidBody)
+			}
+
+			var reader io.Reader
+			switch v := config.Body.(type) {
+			case io.Reader:
+				reader = v
+			case []byte:
+				reader = bytes.NewReader(v)
+			case string:
+				reader = strings.NewReader(v)
+			default:
+				return nil, fmt.Errorf("%w: octet-stream body must be io.Reader, []byte or string", ErrorInvalidBody)
 			}
 
-			body, ok := config.Body.(io.ReadCloser)
-			if !ok && body != nil {
-				body = io.NopCloser(body)
+			body, ok := reader.(io.ReadCloser)
+			if !ok {
+				body = io.NopCloser(reader)
 			}
 
 			req.Body = body
+			if length := readerSize(reader); length > 0 {
+				req.ContentLength = length
+			}
 		} else {
 			if _, ok := config.Body.(string); !ok {
 				return nil, ErrorInvalidBody
@@ -338,53 +282,101 @@ func (f *Fetch) Execute() (*Response, error) {
 		}
 	}
 
-	// unix domain socket: https://gist.github.com/teknoraver/5ffacb8757330715bcbcc90e6d46ac74
-	if config.UnixDomainSocket != "" {
-		// remove unix://
-		// if strings.HasPrefix(config.UnixDomainSocket, "unix://") {
-		// 	config.UnixDomainSocket = config.UnixDomainSocket[7:]
-		// }
-		config.UnixDomainSocket = strings.TrimPrefix(config.UnixDomainSocket, "unix://")
-
-		tr := client.Transport.(*http.Transport)
-		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return net.Dial("unix", config.UnixDomainSocket)
-		}
-	}
-
 	if config.CompressRequest {
 		var buf bytes.Buffer
 		gz := gzip.NewWriter(&buf)
 
 		// Compress the request body
 		if _, err := io.Copy(gz, req.Body); err != nil {
-			return nil, fmt.Errorf("failed to compress request body: %v", err)
+			return nil, newError(ErrorInvalidBody, "failed to compress request body: "+err.Error(), err)
 		}
 		if err := gz.Close(); err != nil {
-			return nil, fmt.Errorf("failed to close gzip writer: %v", err)
+			return nil, newError(ErrorInvalidBody, "failed to close gzip writer: "+err.Error(), err)
 		}
 
 		req.Header.Set(headers.ContentEncoding, "gzip")
-		req.Body = io.NopCloser(&buf)
+		req.Body = io.NopCloser(bytes.NewReader(buf.Bytes()))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+		}
+		req.ContentLength = int64(buf.Len())
 		req.Header.Set(headers.ContentLength, strconv.Itoa(buf.Len()))
 	}
 
+	if err := applyRequestInterceptors(config, req); err != nil {
+		return nil, err
+	}
+
+	// the body is replayable only if it may be sent again, like retries and authentication challenges
+	retryable := config.RetryPolicy != nil && config.RetryPolicy.MaxAttempts > 1 && config.RetryPolicy.isRetryableMethod(req)
+	if retryable || config.DigestAuth != nil || config.OAuth2 != nil || config.Signer != nil || config.AWSSigV4 != nil {
+		body := req.Body
+		// the streaming multipart body is never buffered, see the GetBody of it
+		if _, ok := body.(*multipartBody); !ok {
+			if err := makeBodyReplayableUpTo(req, DefaultMaxReplayBodySize); err != nil {
+				return nil, fmt.Errorf("failed to make request body replayable: %w", err)
+			}
+		}
+
+		// the seekable body is shared by the attempts, so it is closed after all of them
+		if _, ok := body.(io.ReadSeeker); ok && req.Body != body {
+			defer body.Close()
+		}
+	}
+
+	// the download file reports the progress of the response body
+	if config.OnProgress != nil && config.DownloadFilePath == "" && req.Body != nil && req.Body != http.NoBody {
+		withUploadProgress(req, config.OnProgress)
+	}
+
+	var done func(status int, err error)
+	if config.CircuitBreaker != nil {
+		if done, err = config.CircuitBreaker.Allow(config.CircuitBreaker.Key(config, req)); err != nil {
+			return nil, err
+		}
+	}
+
+	var redirects []*Redirect
+	client.CheckRedirect = config.RedirectPolicy.checkRedirect(config, req.Header.Clone(), &redirects)
+
 	resp, err := client.Do(req)
+	if done != nil {
+		if resp != nil {
+			done(resp.StatusCode, err)
+		} else {
+			done(0, err)
+		}
+	}
 
 	if err != nil {
 		// panic("error sending request: " + err.Error())
-		return nil, errors.New("ErrSendingRequest(3):  " + ErrSendingRequest.Error() + ", err: " + err.Error() + "(Please check your network, maybe use bad proxy or network offline)")
+		return nil, newError(ErrSendingRequest, "ErrSendingRequest(3):  "+ErrSendingRequest.Error()+", err: "+err.Error()+"(Please check your network, maybe use bad proxy or network offline)", err)
+	}
+
+	if config.IdleReadTimeout > 0 {
+		resp.Body = newIdleTimeoutReader(resp.Body, config.IdleReadTimeout)
+	}
+
+	// the session is saved only if the cookies are changed,
+	//	and the failure is reported by the response, which is received anyway
+	var sessionErr error
+	if config.SessionStore != nil && config.CookieJar != nil && config.CookieJar.changed() {
+		if err := saveSession(config); err != nil {
+			sessionErr = fmt.Errorf("failed to save session: %w", err)
+		}
 	}
 
 	// Check that the server actually sent compressed data
 	var reader io.ReadCloser
 	switch resp.Header.Get(headers.ContentEncoding) {
 	case "gzip":
-		reader, err = gzip.NewReader(resp.Body)
+		gz, err := gzip.NewReader(resp.Body)
 		if err != nil {
-			return nil, fmt.Errorf("gzip decode error: %s", err)
+			resp.Body.Close()
+			return nil, newError(ErrReadingResponse, fmt.Sprintf("gzip decode error: %s", err), err)
 		}
-		// defer reader.Close()
+		// closing gzip reader does not close the underlying body
+		reader = &gzipReadCloser{Reader: gz, body: resp.Body}
 	default:
 		reader = resp.Body
 	}
@@ -397,25 +389,24 @@ func (f *Fetch) Execute() (*Response, error) {
 		f.SetBasicAuth(config.BasicAuth.Username, config.BasicAuth.Password)
 	}
 
-	if config.IsSession {
-		cookies := resp.Cookies()
-		for _, cookie := range cookies {
-			f.SetCookie(cookie.Name, cookie.Value)
-		}
-	}
-
 	if config.DownloadFilePath != "" {
 		file, err := os.OpenFile(config.DownloadFilePath, os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			return nil, err
+			return nil, newError(ErrReadingResponse, fmt.Sprintf("failed to open download file(%s): %s", config.DownloadFilePath, err), err)
 		}
 		defer file.Close()
 
 		res := &Response{
 			Status:  resp.StatusCode,
+			Proto:   resp.Proto,
 			Headers: resp.Header,
 			//
-			Request: config,
+			Request:  config,
+			Attempts: attempts,
+			//
+			CacheStatus:  cacheStatus(cacher),
+			Redirects:    redirects,
+			SessionError: sessionErr,
 		}
 
 		if f.config.OnProgress != nil {
@@ -426,35 +417,42 @@ func (f *Fetch) Execute() (*Response, error) {
 			}
 
 			_, err = io.Copy(io.MultiWriter(file, progress), reader)
-			if err != nil {
-				return nil, err
-			}
 		} else {
 			_, err = io.Copy(file, reader)
-			if err != nil {
-				return nil, err
-			}
 		}
+		if err != nil {
+			return nil, newError(ErrReadingResponse, fmt.Sprintf("failed to download file(%s): %s", config.DownloadFilePath, err), err)
+		}
+
+		res.Timing = tracer.timing(time.Now())
 
-		return res, nil
+		return checkStatus(applyResponseInterceptors(config, res))
 	}
 
 	if config.IsStream {
-		return &Response{
+		return checkStatus(applyResponseInterceptors(config, &Response{
 			Status:  resp.StatusCode,
+			Proto:   resp.Proto,
 			Headers: resp.Header,
 			//
-			Request: config,
+			Request:  config,
+			Attempts: attempts,
+			//
+			CacheStatus:  cacheStatus(cacher),
+			Redirects:    redirects,
+			Timing:       tracer.timing(time.Time{}),
+			SessionError: sessionErr,
 			//
 			Stream: reader,
-		}, nil
+		}))
 	}
 
 	body, err := ioutil.ReadAll(reader)
 	if err != nil {
 		// panic("error reading response: " + err.Error())
-		return nil, errors.New("ErrReadingResponse(4): " + ErrReadingResponse.Error() + ", err: " + err.Error())
+		return nil, newError(ErrReadingResponse, "ErrReadingResponse(4): "+ErrReadingResponse.Error()+", err: "+err.Error(), err)
 	}
+	timing := tracer.timing(time.Now())
 
 	// fmt.Println("response: ", string(body))
 
@@ -471,26 +469,32 @@ func (f *Fetch) Execute() (*Response, error) {
 		}
 	}
 
-	return &Response{
+	return checkStatus(applyResponseInterceptors(config, &Response{
 		Status:  resp.StatusCode,
+		Proto:   resp.Proto,
 		Headers: resp.Header,
 		Body:    body,
 		//
-		Request: config,
-	}, nil
+		Request:  config,
+		Attempts: attempts,
+		//
+		CacheStatus:  cacheStatus(cacher),
+		Redirects:    redirects,
+		Timing:       timing,
+		SessionError: sessionErr,
+	}))
 }
 
-// @TODO for multipart/form-data with file
-//
-//		Issue:
-//			mime/multipart:CreateFormFile has a fixed content type(application/octet-stream),
-//			does not support auto-detect content type
-//
-//		Need: Create MIME encoded form files that auto-detect the content type.
-//
-//		Reference:
-//	 	1. https://groups.google.com/g/golang-nuts/c/HwOYproYQqA
-//	 	2. https://github.com/go-openapi/runtime/pull/170/files
+// gzipReadCloser closes both the gzip reader and the underlying body
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
 
 // NamedReadCloser is a named reader
 type NamedReadCloser interface {
@@ -503,45 +507,6 @@ func escapeQuotes(s string) string {
 	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(s)
 }
 
-func createFormFile(w *multipart.Writer, reader io.ReadCloser, fieldname string) error {
-	buf := bytes.NewBuffer([]byte{})
-	filename := ""
-	if f, ok := reader.(NamedReadCloser); ok {
-		filename = f.Name()
-	}
-
-	// Need to read the data so that we can detect the content type
-	if _, err := io.Copy(buf, reader); err != nil {
-		return err
-	}
-	fileBytes := buf.Bytes()
-	fileContentType := http.DetectContentType(fileBytes)
-
-	newFi := CreateNamedReader(filename, buf)
-
-	h := make(textproto.MIMEHeader)
-	if filename == "" {
-		h.Set("Content-Disposition",
-			fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(fieldname)))
-	} else {
-		h.Set("Content-Disposition",
-			fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
-				escapeQuotes(fieldname), escapeQuotes(filename)))
-	}
-	h.Set("Content-Type", fileContentType)
-
-	fw, err := w.CreatePart(h)
-	if err != nil {
-		return err
-	}
-
-	if _, err = io.Copy(fw, newFi); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // CreateNamedReader creates a named reader
 //
 //		multipart.File, that is Request.ParseMultipartForm, does not have a name
@@ -553,14 +518,17 @@ func CreateNamedReader(name string, rdr io.Reader) NamedReadCloser {
 		rc = io.NopCloser(rdr)
 	}
 	return &namedReadCloser{
-		name: name,
-		cr:   rc,
+		name:   name,
+		cr:     rc,
+		reader: rdr,
 	}
 }
 
 type namedReadCloser struct {
 	name string
 	cr   io.ReadCloser
+	// reader is the original reader, for the size
+	reader io.Reader
 }
 
 func (n *namedReadCloser) Close() error {
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -180,6 +184,40 @@ func TestSetHeader(t *testing.T) {
 	testify.Equal(t, "d", f.config.Headers.Get("c"))
 }
 
+func TestAddHeaderAndQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(r.Header.Values("Accept"), ",") + "|" +
+			strings.Join(r.Header.Values("X-Forwarded-For"), ",") + "|" +
+			r.URL.RawQuery))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL+"/?token=t1&token=t2").
+		SetHeader("Accept", "text/html").
+		AddHeader("Accept", "application/json", "*/*").
+		AddHeader("X-Forwarded-For", "10.0.0.1").
+		AddQuery("id", "1", "2")
+
+	response, err := f.Clone().Get("/items?page=1&page=2").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "text/html,application/json,*/*|10.0.0.1|id=1&id=2&page=1&page=2&token=t1&token=t2", response.String())
+
+	// set replaces the added values
+	response, err = f.Clone().
+		SetHeader("X-Forwarded-For", "10.0.0.2").
+		SetQuery("id", "3").
+		Get("/items", &Config{
+			QueryValues: url.Values{"tag": {"a", "b"}},
+		}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "text/html,application/json,*/*|10.0.0.2|id=3&tag=a&tag=b&token=t1&token=t2", response.String())
+}
+
 func TestSetParams(t *testing.T) {
 	f := New()
 	f.SetParam("a", "b")
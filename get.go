@@ -13,5 +13,5 @@ func Get(url string, config ...interface{}) (*Response, error) {
 		panic("Request with GET method cannot have body")
 	}
 
-	return New().Get(url, c).Execute()
+	return shared().Get(url, c).Execute()
 }
@@ -14,6 +14,15 @@ var Timeout = 60 * time.Second
 // UserAgent is the default user agent
 var UserAgent = fmt.Sprintf("GoFetch/%s (github.com/go-zoox/fetch)", Version)
 
+// Middlewares is the default middlewares, applied before the middlewares of fetch
+var Middlewares []Middleware
+
+// RequestInterceptors is the default request interceptors, applied before the interceptors of fetch
+var RequestInterceptors []RequestInterceptor
+
+// ResponseInterceptors is the default response interceptors, applied before the interceptors of fetch
+var ResponseInterceptors []ResponseInterceptor
+
 // @TODO
 // var Headers = make(ConfigHeaders)
 
@@ -32,6 +41,30 @@ func SetUserAgent(userAgent string) {
 	UserAgent = userAgent
 }
 
+// Use adds the default middlewares
+func Use(middlewares ...Middleware) {
+	Middlewares = append(Middlewares, middlewares...)
+}
+
+// UseRequestInterceptor adds the default request interceptors
+func UseRequestInterceptor(interceptors ...RequestInterceptor) {
+	RequestInterceptors = append(RequestInterceptors, interceptors...)
+}
+
+// UseResponseInterceptor adds the default response interceptors
+func UseResponseInterceptor(interceptors ...ResponseInterceptor) {
+	ResponseInterceptors = append(ResponseInterceptors, interceptors...)
+}
+
+// shared creates a fetch for the package level methods, like fetch.Get,
+//
+//	which share the connection pool with each other.
+func shared() *Fetch {
+	f := New()
+	f.transports = defaultTransports
+	return f
+}
+
 // func SetHeader(key, value string) {
 // 	Headers[key] = value
 // }
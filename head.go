@@ -13,5 +13,5 @@ func Head(url string, config ...interface{}) (*Response, error) {
 		panic("Request with HEAD method cannot have body")
 	}
 
-	return New().Head(url, c).Execute()
+	return shared().Head(url, c).Execute()
 }
@@ -0,0 +1,437 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"golang.org/x/net/proxy"
+)
+
+// h2cSettings is the HTTP2-Settings header value of upgrade request,
+//
+//	which only disables server push.
+var h2cSettings = base64.RawURLEncoding.EncodeToString([]byte{0, byte(http2.SettingEnablePush), 0, 0, 0, 0})
+
+// configureHTTP2 forces HTTP/2 over TLS, the tls handshake fails if the server does not support h2
+func configureHTTP2(transport *http.Transport) error {
+	if _, err := http2.ConfigureTransports(transport); err != nil {
+		return fmt.Errorf("failed to configure http2: %w", err)
+	}
+
+	// only h2 is acceptable, ConfigureTransports also appends http/1.1
+	transport.TLSClientConfig.NextProtos = []string{http2.NextProtoTLS}
+	return nil
+}
+
+// h2cTransport speaks HTTP/2 over cleartext TCP for http:// urls,
+//
+//	https:// urls are still sent by the origin transport.
+type h2cTransport struct {
+	mode string
+	//
+	http1 *http.Transport
+	http2 *http2.Transport
+	// upgraded is the hosts which have been upgraded to h2c,
+	//	then requests are sent with prior knowledge.
+	upgraded sync.Map
+}
+
+func newH2CTransport(mode string, transport *http.Transport) (*h2cTransport, error) {
+	if mode != H2CPriorKnowledge && mode != H2CUpgrade {
+		return nil, fmt.Errorf("unsupport h2c mode(%s)", mode)
+	}
+
+	return &h2cTransport{
+		mode:  mode,
+		http1: transport,
+		http2: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dialH2C(ctx, transport, network, addr)
+			},
+			IdleConnTimeout:    transport.IdleConnTimeout,
+			DisableCompression: transport.DisableCompression,
+		},
+	}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" {
+		return t.http1.RoundTrip(req)
+	}
+
+	if t.mode == H2CPriorKnowledge {
+		return t.http2.RoundTrip(req)
+	}
+
+	if _, ok := t.upgraded.Load(req.URL.Host); ok {
+		return t.http2.RoundTrip(req)
+	}
+
+	return t.upgrade(req)
+}
+
+// CloseIdleConnections closes the idle connections of both HTTP/1.1 and h2c
+func (t *h2cTransport) CloseIdleConnections() {
+	t.http1.CloseIdleConnections()
+	t.http2.CloseIdleConnections()
+}
+
+// upgrade sends the request with HTTP/1.1 Upgrade header,
+//
+//	if the server switches protocols, the response is read from stream 1 of the h2c connection.
+//	see https://www.rfc-editor.org/rfc/rfc7540#section-3.2
+func (t *h2cTransport) upgrade(req *http.Request) (*http.Response, error) {
+	upgradeReq := req.Clone(req.Context())
+	upgradeReq.Header.Set("Connection", "Upgrade, HTTP2-Settings")
+	upgradeReq.Header.Set("Upgrade", "h2c")
+	upgradeReq.Header.Set("HTTP2-Settings", h2cSettings)
+
+	resp, err := t.http1.RoundTrip(upgradeReq)
+	if err != nil {
+		return nil, err
+	}
+
+	// server does not support h2c, keep HTTP/1.1
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return resp, nil
+	}
+
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: connection is not writable", ErrH2CUpgradeFailed)
+	}
+
+	t.upgraded.Store(req.URL.Host, true)
+
+	return readH2CUpgradeResponse(req, conn)
+}
+
+func readH2CUpgradeResponse(req *http.Request, conn io.ReadWriteCloser) (*http.Response, error) {
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", ErrH2CUpgradeFailed, err)
+	}
+
+	framer := http2.NewFramer(conn, conn)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := framer.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 0}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", ErrH2CUpgradeFailed, err)
+	}
+
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %v", ErrH2CUpgradeFailed, err)
+		}
+
+		if handled, err := handleH2CControlFrame(framer, frame); handled {
+			if err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("%w: %v", ErrH2CUpgradeFailed, err)
+			}
+
+			continue
+		}
+
+		headers, ok := frame.(*http2.MetaHeadersFrame)
+		if !ok || headers.StreamID != 1 {
+			continue
+		}
+
+		resp, err := newH2CResponse(req, headers)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		// informational responses, like 100 Continue
+		if resp.StatusCode < 200 {
+			continue
+		}
+
+		if headers.StreamEnded() {
+			conn.Close()
+			resp.Body = http.NoBody
+			return resp, nil
+		}
+
+		pr, pw := io.Pipe()
+		resp.Body = &h2cBody{PipeReader: pr, conn: conn}
+		go readH2CUpgradeBody(framer, resp, pw, conn)
+
+		return resp, nil
+	}
+}
+
+// handleH2CControlFrame handles the connection level frames,
+//
+//	returns true if the frame is handled.
+func handleH2CControlFrame(framer *http2.Framer, frame http2.Frame) (bool, error) {
+	switch f := frame.(type) {
+	case *http2.SettingsFrame:
+		if !f.IsAck() {
+			return true, framer.WriteSettingsAck()
+		}
+		return true, nil
+	case *http2.PingFrame:
+		if !f.IsAck() {
+			return true, framer.WritePing(true, f.Data)
+		}
+		return true, nil
+	case *http2.WindowUpdateFrame:
+		return true, nil
+	case *http2.GoAwayFrame:
+		return true, fmt.Errorf("server sent GOAWAY(%s)", f.ErrCode)
+	case *http2.RSTStreamFrame:
+		if f.StreamID == 1 {
+			return true, fmt.Errorf("server reset stream(%s)", f.ErrCode)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func newH2CResponse(req *http.Request, headers *http2.MetaHeadersFrame) (*http.Response, error) {
+	status := headers.PseudoValue("status")
+	statusCode, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid status(%s)", ErrH2CUpgradeFailed, status)
+	}
+
+	resp := &http.Response{
+		Status:        status + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		ProtoMinor:    0,
+		Header:        make(http.Header),
+		Trailer:       make(http.Header),
+		ContentLength: -1,
+		Request:       req,
+	}
+
+	for _, field := range headers.RegularFields() {
+		resp.Header.Add(http.CanonicalHeaderKey(field.Name), field.Value)
+	}
+
+	if cl := resp.Header.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil {
+			resp.ContentLength = n
+		}
+	}
+
+	return resp, nil
+}
+
+func readH2CUpgradeBody(framer *http2.Framer, resp *http.Response, pw *io.PipeWriter, conn io.Closer) {
+	defer conn.Close()
+
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		if handled, err := handleH2CControlFrame(framer, frame); handled {
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			continue
+		}
+
+		switch f := frame.(type) {
+		case *http2.DataFrame:
+			if f.StreamID != 1 {
+				continue
+			}
+
+			if data := f.Data(); len(data) > 0 {
+				if _, err := pw.Write(data); err != nil {
+					return
+				}
+
+				// the data has been consumed, give the window back
+				if err := framer.WriteWindowUpdate(0, uint32(f.Length)); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				if !f.StreamEnded() {
+					if err := framer.WriteWindowUpdate(1, uint32(f.Length)); err != nil {
+						pw.CloseWithError(err)
+						return
+					}
+				}
+			}
+
+			if f.StreamEnded() {
+				pw.Close()
+				return
+			}
+		case *http2.MetaHeadersFrame:
+			// trailers
+			if f.StreamID != 1 {
+				continue
+			}
+
+			for _, field := range f.RegularFields() {
+				resp.Trailer.Add(http.CanonicalHeaderKey(field.Name), field.Value)
+			}
+
+			if f.StreamEnded() {
+				pw.Close()
+				return
+			}
+		}
+	}
+}
+
+// h2cBody is the body of upgraded response, closes the connection when closed
+type h2cBody struct {
+	*io.PipeReader
+	conn io.Closer
+}
+
+func (b *h2cBody) Close() error {
+	b.PipeReader.Close()
+	return b.conn.Close()
+}
+
+// dialH2C dials the h2c connection with the dialer of origin transport,
+//
+//	which supports unix domain socket,
+//	socks5 proxy is dialed by the socks5 dialer, http proxy is supported by CONNECT tunnel.
+func dialH2C(ctx context.Context, transport *http.Transport, network, addr string) (net.Conn, error) {
+	var proxyURL *url.URL
+	if transport.Proxy != nil {
+		u, err := transport.Proxy((&http.Request{URL: &url.URL{Scheme: "http", Host: addr}}).WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		proxyURL = u
+	}
+
+	if proxyURL == nil {
+		return transport.DialContext(ctx, network, addr)
+	}
+
+	if proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h" {
+		dialer, err := proxy.FromURL(proxyURL, contextDialer(transport.DialContext))
+		if err != nil {
+			return nil, fmt.Errorf("invalid socks5 proxy: %s", proxyURL.Redacted())
+		}
+
+		if d, ok := dialer.(proxy.ContextDialer); ok {
+			return d.DialContext(ctx, network, addr)
+		}
+
+		return dialer.Dial(network, addr)
+	}
+
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		if proxyURL.Scheme == "https" {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "443")
+		} else {
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+	}
+
+	conn, err := transport.DialContext(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConfig := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			tlsConfig = transport.TLSClientConfig.Clone()
+			tlsConfig.NextProtos = nil
+		}
+		tlsConfig.ServerName = proxyURL.Hostname()
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		conn = tlsConn
+	}
+
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if transport.GetProxyConnectHeader != nil {
+		header, err := transport.GetProxyConnectHeader(ctx, proxyURL, addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		for key, values := range header {
+			connectReq.Header[key] = values
+		}
+	}
+	if proxyURL.User != nil && connectReq.Header.Get("Proxy-Authorization") == "" {
+		password, _ := proxyURL.User.Password()
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username()+":"+password)))
+	}
+
+	if err := connectReq.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, connectReq)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT failed: %s", strings.TrimSpace(resp.Status))
+	}
+
+	return conn, nil
+}
+
+// contextDialer adapts the dial function to proxy.Dialer
+type contextDialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dial implements proxy.Dialer
+func (d contextDialer) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
+}
+
+// DialContext implements proxy.ContextDialer
+func (d contextDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d(ctx, network, addr)
+}
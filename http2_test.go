@@ -0,0 +1,125 @@
+package fetch
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-zoox/testify"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/http2/hpack"
+)
+
+func newH2CTestHandler() http.Handler {
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + string(body)))
+	}), &http2.Server{})
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	response, err := New().SetHTTP2(true).Get(server.URL, &Config{TLSInsecureSkipVerify: true}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, "HTTP/2.0", response.Proto)
+	testify.Equal(t, "HTTP/2.0", response.String())
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	server := httptest.NewServer(newH2CTestHandler())
+	defer server.Close()
+
+	response, err := New().SetH2C(H2CPriorKnowledge).Get(server.URL).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, "HTTP/2.0", response.Proto)
+	testify.Equal(t, "GET ", response.String())
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	server := httptest.NewServer(newH2CTestHandler())
+	defer server.Close()
+
+	f := New().SetH2C(H2CUpgrade)
+
+	response, err := f.Clone().Post(server.URL, &Config{Body: "hello"}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "HTTP/2.0", response.Proto)
+	testify.Equal(t, "POST hello", response.String())
+
+	// upgraded host uses prior knowledge
+	response, err = f.Clone().Get(server.URL).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "HTTP/2.0", response.Proto)
+	testify.Equal(t, "GET ", response.String())
+}
+
+func TestH2CUpgradeFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	defer server.Close()
+
+	response, err := New().SetH2C(H2CUpgrade).Get(server.URL).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, "HTTP/1.1", response.Proto)
+	testify.Equal(t, "HTTP/1.1", response.String())
+}
+
+func TestH2CUnixDomainSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "h2c.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: newH2CTestHandler()}
+	go server.Serve(listener)
+	defer server.Close()
+
+	response, err := New().Get("http://unix/", &Config{
+		UnixDomainSocket: socket,
+		H2C:              H2CPriorKnowledge,
+	}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, "HTTP/2.0", response.Proto)
+}
+
+func TestH2CInvalidMode(t *testing.T) {
+	_, err := New().SetH2C("invalid").Get("http://127.0.0.1").Execute()
+	testify.Assert(t, err != nil, "Expected error, got nil")
+}
+
+func TestH2CInvalidStatus(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+	_, err := newH2CResponse(req, &http2.MetaHeadersFrame{
+		Fields: []hpack.HeaderField{{Name: ":status", Value: "invalid"}},
+	})
+	testify.Assert(t, errors.Is(err, ErrH2CUpgradeFailed), "Expected ErrH2CUpgradeFailed")
+}
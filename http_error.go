@@ -0,0 +1,128 @@
+package fetch
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"github.com/go-zoox/headers"
+)
+
+// ProblemContentType is the content type of problem details, see RFC 9457
+const ProblemContentType = "application/problem+json"
+
+// HTTPError is the error of the response with unexpected status
+type HTTPError struct {
+	Status  int
+	Headers http.Header
+	Body    []byte
+	// Request is the config of the request
+	Request *Config
+	// Response is the response of the request
+	Response *Response
+	// Problem is the problem details if the body is application/problem+json
+	Problem *Problem
+}
+
+// Problem is the problem details of HTTP APIs, see RFC 9457
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extensions are the extension members, like errors, balance
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// NewHTTPError creates an HTTPError from the response,
+//
+//	the problem+json body is parsed into Problem.
+func NewHTTPError(response *Response) *HTTPError {
+	e := &HTTPError{
+		Status:   response.Status,
+		Headers:  response.Headers,
+		Body:     response.Body,
+		Request:  response.Request,
+		Response: response,
+	}
+
+	if isProblemContentType(response.Headers.Get(headers.ContentType)) {
+		e.Problem, _ = ParseProblem(response.Body)
+	}
+
+	return e
+}
+
+// Error implements error
+func (e *HTTPError) Error() string {
+	if e.Problem != nil && (e.Problem.Title != "" || e.Problem.Detail != "") {
+		switch {
+		case e.Problem.Title == "":
+			return fmt.Sprintf("[%d] %s", e.Status, e.Problem.Detail)
+		case e.Problem.Detail == "":
+			return fmt.Sprintf("[%d] %s", e.Status, e.Problem.Title)
+		}
+
+		return fmt.Sprintf("[%d] %s: %s", e.Status, e.Problem.Title, e.Problem.Detail)
+	}
+
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("[%d] %s", e.Status, http.StatusText(e.Status))
+	}
+
+	return fmt.Sprintf("[%d] %s", e.Status, string(e.Body))
+}
+
+// Is reports whether the target is ErrUnexpectedStatus
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrUnexpectedStatus
+}
+
+// ParseProblem parses the problem details, the unknown members are kept in Extensions
+func ParseProblem(body []byte) (*Problem, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, fmt.Errorf("invalid problem details: %w", err)
+	}
+
+	// members with the wrong type are ignored, see RFC 9457 section 3.1
+	problem := &Problem{}
+	for key, raw := range members {
+		switch key {
+		case "type":
+			json.Unmarshal(raw, &problem.Type)
+		case "title":
+			json.Unmarshal(raw, &problem.Title)
+		case "status":
+			json.Unmarshal(raw, &problem.Status)
+		case "detail":
+			json.Unmarshal(raw, &problem.Detail)
+		case "instance":
+			json.Unmarshal(raw, &problem.Instance)
+		default:
+			var value interface{}
+			if err := json.Unmarshal(raw, &value); err != nil {
+				continue
+			}
+
+			if problem.Extensions == nil {
+				problem.Extensions = map[string]interface{}{}
+			}
+			problem.Extensions[key] = value
+		}
+	}
+
+	return problem, nil
+}
+
+func isProblemContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(mediaType, ProblemContentType)
+}
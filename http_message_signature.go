@@ -0,0 +1,300 @@
+package fetch
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-zoox/core-utils/fmt"
+)
+
+// HTTP Message Signatures algorithms, see RFC 9421 section 3.3
+const (
+	HTTPSignatureHMACSHA256      = "hmac-sha256"
+	HTTPSignatureEd25519         = "ed25519"
+	HTTPSignatureRSAPSSSHA512    = "rsa-pss-sha512"
+	HTTPSignatureRSAV15SHA256    = "rsa-v1_5-sha256"
+	HTTPSignatureECDSAP256SHA256 = "ecdsa-p256-sha256"
+)
+
+const (
+	defaultHTTPSignatureLabel     = "sig1"
+	httpSignatureParamsComponent  = "@signature-params"
+	httpSignatureContentDigestKey = "content-digest"
+)
+
+// HTTPSignatureConfig is the config of HTTP Message Signatures (RFC 9421) signer
+type HTTPSignatureConfig struct {
+	KeyID string
+	// Algorithm is the signature algorithm, like hmac-sha256, ed25519
+	Algorithm string
+	// Key is the signing key,
+	//	[]byte for hmac-sha256, ed25519.PrivateKey, *rsa.PrivateKey, *ecdsa.PrivateKey
+	Key interface{} `json:"-"`
+
+	// Components are the covered components, derived components start with @,
+	//	default: @method, @authority, @path, @query, and content-digest if ContentDigest is set and the body exists
+	Components []string
+	// Label is the signature label, default sig1
+	Label string
+	// IncludeAlg includes the alg parameter
+	IncludeAlg bool
+	// Expires adds the expires parameter, which is created + Expires
+	Expires time.Duration
+	// Nonce adds a random nonce parameter
+	Nonce bool
+	// Tag is the application specific tag parameter
+	Tag string
+	// ContentDigest adds the Content-Digest header (RFC 9530) of the body with sha-256
+	ContentDigest bool
+
+	// Now returns the signing time, default SigningTime
+	Now func() time.Time `json:"-"`
+}
+
+// HTTPSignatureSigner signs the request by HTTP Message Signatures (RFC 9421)
+type HTTPSignatureSigner struct {
+	clockSkews
+	config *HTTPSignatureConfig
+}
+
+// NewHTTPSignatureSigner creates an HTTP Message Signatures signer
+func NewHTTPSignatureSigner(cfg *HTTPSignatureConfig) *HTTPSignatureSigner {
+	return &HTTPSignatureSigner{
+		config: cfg,
+	}
+}
+
+// Sign implements Signer, sets the Signature-Input and Signature headers
+func (s *HTTPSignatureSigner) Sign(req *http.Request) error {
+	components := s.config.Components
+	if len(components) == 0 {
+		components = []string{"@method", "@authority", "@path", "@query"}
+	}
+
+	if s.config.ContentDigest && req.Body != nil && req.Body != http.NoBody {
+		body, err := readSigningBody(req)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(body)
+		req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+
+		if len(s.config.Components) == 0 {
+			components = append(components, httpSignatureContentDigestKey)
+		}
+	}
+
+	now := s.clockSkews.now(req.URL.Host)
+	if s.config.Now != nil {
+		now = s.config.Now()
+	}
+
+	params, err := s.signatureParams(components, now)
+	if err != nil {
+		return err
+	}
+
+	var base strings.Builder
+	for _, component := range components {
+		value, err := httpSignatureComponent(req, component)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&base, "%q: %s\n", strings.ToLower(component), value)
+	}
+	fmt.Fprintf(&base, "%q: %s", httpSignatureParamsComponent, params)
+
+	signature, err := s.sign([]byte(base.String()))
+	if err != nil {
+		return err
+	}
+
+	label := orDefault(s.config.Label, defaultHTTPSignatureLabel)
+	req.Header.Set("Signature-Input", label+"="+params)
+	req.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+
+	return nil
+}
+
+// signatureParams returns the serialized signature params, see RFC 9421 section 2.3
+func (s *HTTPSignatureSigner) signatureParams(components []string, created time.Time) (string, error) {
+	quoted := make([]string, len(components))
+	for i, component := range components {
+		quoted[i] = strconv.Quote(strings.ToLower(component))
+	}
+
+	params := "(" + strings.Join(quoted, " ") + ");created=" + strconv.FormatInt(created.Unix(), 10)
+
+	if s.config.Expires > 0 {
+		params += ";expires=" + strconv.FormatInt(created.Add(s.config.Expires).Unix(), 10)
+	}
+
+	if s.config.Nonce {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+
+		params += ";nonce=" + strconv.Quote(hex.EncodeToString(nonce))
+	}
+
+	if s.config.IncludeAlg {
+		params += ";alg=" + strconv.Quote(s.config.Algorithm)
+	}
+
+	if s.config.KeyID != "" {
+		params += ";keyid=" + strconv.Quote(s.config.KeyID)
+	}
+
+	if s.config.Tag != "" {
+		params += ";tag=" + strconv.Quote(s.config.Tag)
+	}
+
+	return params, nil
+}
+
+func (s *HTTPSignatureSigner) sign(base []byte) ([]byte, error) {
+	switch s.config.Algorithm {
+	case HTTPSignatureHMACSHA256:
+		key, ok := s.config.Key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("%s requires []byte key", s.config.Algorithm)
+		}
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	case HTTPSignatureEd25519:
+		key, ok := s.config.Key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires ed25519.PrivateKey", s.config.Algorithm)
+		}
+
+		return ed25519.Sign(key, base), nil
+	case HTTPSignatureRSAPSSSHA512:
+		key, ok := s.config.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires *rsa.PrivateKey", s.config.Algorithm)
+		}
+
+		digest := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, key, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+	case HTTPSignatureRSAV15SHA256:
+		key, ok := s.config.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires *rsa.PrivateKey", s.config.Algorithm)
+		}
+
+		digest := sha256.Sum256(base)
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case HTTPSignatureECDSAP256SHA256:
+		key, ok := s.config.Key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires *ecdsa.PrivateKey", s.config.Algorithm)
+		}
+
+		digest := sha256.Sum256(base)
+		r, ss, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return nil, err
+		}
+
+		// the signature is r || s, each 32 bytes
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		ss.FillBytes(signature[32:])
+		return signature, nil
+	}
+
+	return nil, fmt.Errorf("unsupported http signature algorithm: %s", s.config.Algorithm)
+}
+
+// httpSignatureComponent returns the value of the component, see RFC 9421 section 2
+func httpSignatureComponent(req *http.Request, component string) (string, error) {
+	switch component = strings.ToLower(component); component {
+	case "@method":
+		return req.Method, nil
+	case "@target-uri":
+		return httpSignatureScheme(req) + "://" + httpSignatureAuthority(req) + req.URL.RequestURI(), nil
+	case "@authority":
+		return httpSignatureAuthority(req), nil
+	case "@scheme":
+		return httpSignatureScheme(req), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		path := req.URL.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+
+		return path, nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+
+	if strings.HasPrefix(component, "@") {
+		return "", fmt.Errorf("unsupported http signature component: %s", component)
+	}
+
+	values := req.Header.Values(component)
+	if len(values) == 0 {
+		// the fields are not in headers of the client request
+		switch {
+		case component == "host":
+			return httpSignatureAuthority(req), nil
+		case component == "content-length" && req.ContentLength > 0:
+			return strconv.FormatInt(req.ContentLength, 10), nil
+		}
+
+		return "", fmt.Errorf("http signature component %s is missing in request headers", component)
+	}
+
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+
+	return strings.Join(trimmed, ", "), nil
+}
+
+func httpSignatureScheme(req *http.Request) string {
+	if req.URL.Scheme == "" {
+		return "http"
+	}
+
+	return strings.ToLower(req.URL.Scheme)
+}
+
+// httpSignatureAuthority returns the lowercase host, the default port is omitted
+func httpSignatureAuthority(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host = strings.ToLower(host)
+
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		scheme := httpSignatureScheme(req)
+		if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+			return h
+		}
+	}
+
+	return host
+}
@@ -0,0 +1,92 @@
+package fetch
+
+import (
+	"net/http"
+)
+
+// RequestInterceptor intercepts the built request before it is sent,
+//
+//	it can mutate the request, like injecting tracing headers.
+type RequestInterceptor func(req *http.Request) error
+
+// ResponseInterceptor intercepts the response before it is returned,
+//
+//	it can inspect or mutate the response, like logging and metrics.
+type ResponseInterceptor func(resp *Response) error
+
+// Middleware wraps the whole exchange, round-tripper style,
+//
+//	the first registered middleware is the outermost one. The middlewares are outside of
+//	the cache, retries, rate limit and auth, so they are not called again for the retries,
+//	and see the request before it is signed.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to allow the use of ordinary functions as http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (fn RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// Use adds the middlewares to the fetch
+func (f *Fetch) Use(middlewares ...Middleware) *Fetch {
+	f.config.Middlewares = append(f.config.Middlewares, middlewares...)
+	return f
+}
+
+// UseRequestInterceptor adds the request interceptors to the fetch
+func (f *Fetch) UseRequestInterceptor(interceptors ...RequestInterceptor) *Fetch {
+	f.config.RequestInterceptors = append(f.config.RequestInterceptors, interceptors...)
+	return f
+}
+
+// UseResponseInterceptor adds the response interceptors to the fetch
+func (f *Fetch) UseResponseInterceptor(interceptors ...ResponseInterceptor) *Fetch {
+	f.config.ResponseInterceptors = append(f.config.ResponseInterceptors, interceptors...)
+	return f
+}
+
+// applyMiddlewares wraps the transport with global and config middlewares
+func applyMiddlewares(config *Config, transport http.RoundTripper) http.RoundTripper {
+	middlewares := append(append([]Middleware{}, Middlewares...), config.Middlewares...)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+
+	return transport
+}
+
+// applyRequestInterceptors runs the global and config request interceptors in order
+func applyRequestInterceptors(config *Config, req *http.Request) error {
+	for _, interceptor := range RequestInterceptors {
+		if err := interceptor(req); err != nil {
+			return err
+		}
+	}
+
+	for _, interceptor := range config.RequestInterceptors {
+		if err := interceptor(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyResponseInterceptors runs the global and config response interceptors in order
+func applyResponseInterceptors(config *Config, response *Response) (*Response, error) {
+	for _, interceptor := range ResponseInterceptors {
+		if err := interceptor(response); err != nil {
+			return response, err
+		}
+	}
+
+	for _, interceptor := range config.ResponseInterceptors {
+		if err := interceptor(response); err != nil {
+			return response, err
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,151 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func TestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Trace")))
+	}))
+	defer server.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+":before")
+				req.Header.Add("X-Trace", name)
+				resp, err := next.RoundTrip(req)
+				order = append(order, name+":after")
+				return resp, err
+			})
+		}
+	}
+
+	f := Create(server.URL).Use(trace("a"), trace("b"))
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, "a", response.String())
+	testify.Equal(t, "a:before,b:before,b:after,a:after", strings.Join(order, ","))
+}
+
+func TestMiddlewareOutsideRetry(t *testing.T) {
+	server, count := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	var calls int32
+	var signature string
+	response, err := New().
+		SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond}).
+		SetSigner(NewHMACSigner(&HMACSignerConfig{KeyID: "id", Secret: "secret"})).
+		Use(func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				signature = req.Header.Get("X-Signature")
+				return next.RoundTrip(req)
+			})
+		}).
+		Get(server.URL).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, 2, response.Attempts)
+	testify.Equal(t, int32(2), atomic.LoadInt32(count))
+	testify.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	testify.Equal(t, "", signature)
+}
+
+func TestRequestInterceptor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	response, err := New().
+		UseRequestInterceptor(func(req *http.Request) error {
+			req.Header.Set("Authorization", "Bearer token")
+			return nil
+		}).
+		Get(server.URL).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "Bearer token", response.String())
+
+	errInterceptor := errors.New("interceptor error")
+	_, err = New().
+		UseRequestInterceptor(func(req *http.Request) error {
+			return errInterceptor
+		}).
+		Get(server.URL).
+		Execute()
+	testify.Assert(t, errors.Is(err, errInterceptor), "Expected interceptor error")
+}
+
+func TestResponseInterceptor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var status int
+	response, err := Get(server.URL, &Config{
+		ResponseInterceptors: []ResponseInterceptor{
+			func(resp *Response) error {
+				status = resp.Status
+				resp.Headers.Set("X-Intercepted", "true")
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, http.StatusOK, status)
+	testify.Equal(t, "true", response.Headers.Get("X-Intercepted"))
+}
+
+func TestGlobalInterceptors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Global") + "," + r.Header.Get("X-Local")))
+	}))
+	defer server.Close()
+
+	UseRequestInterceptor(func(req *http.Request) error {
+		req.Header.Set("X-Global", "global")
+		req.Header.Set("X-Local", "global")
+		return nil
+	})
+	defer func() {
+		RequestInterceptors = nil
+	}()
+
+	response, err := New().
+		UseRequestInterceptor(func(req *http.Request) error {
+			req.Header.Set("X-Local", "local")
+			return nil
+		}).
+		Get(server.URL).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, "global,local", response.String())
+}
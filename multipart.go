@@ -0,0 +1,480 @@
+package fetch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-zoox/core-utils/fmt"
+)
+
+// sniffLen is the max length of the data to detect the content type, see http.DetectContentType
+const sniffLen = 512
+
+// MultipartBody is the builder of multipart/form-data body, which can be used as Config.Body,
+//
+//	the parts are sent in order, and the same field can be added repeatedly, like tags[].
+//	The readers are consumed by sending, while the file paths are opened for every request.
+type MultipartBody struct {
+	parts []*MultipartPart
+	err   error
+}
+
+// MultipartPart is a part of MultipartBody, the content is Path, Reader or Value
+type MultipartPart struct {
+	// Name is the form field name
+	Name string
+	// Filename is the file name, default is the base name of Path or Reader.Name()
+	Filename string
+	// ContentType is the content type,
+	//	default is detected by the extension of Path or the first 512 bytes of Reader
+	ContentType string
+	// Headers are the extra headers of the part
+	Headers Headers
+
+	// Path is the file path, which is opened lazily when the part is sent
+	Path string
+	// Reader is the file content
+	Reader io.Reader
+	// Value is the field value
+	Value string
+}
+
+// NewMultipartBody creates a multipart/form-data body builder
+func NewMultipartBody() *MultipartBody {
+	return &MultipartBody{}
+}
+
+// AddField adds the field, multiple values are added as the repeated fields,
+//
+//	the value is string, bool, number or fmt.Stringer.
+func (b *MultipartBody) AddField(name string, values ...interface{}) *MultipartBody {
+	for _, value := range values {
+		text, ok := formatMultipartValue(value)
+		if !ok {
+			b.setError(fmt.Errorf("%w: unsupported value type of field(%s): %T", ErrInvalidBodyMultipart, name, value))
+			continue
+		}
+
+		b.AddPart(&MultipartPart{
+			Name:  name,
+			Value: text,
+		})
+	}
+
+	return b
+}
+
+// AddFile adds the file of the reader, empty filename means the name of reader if it has
+func (b *MultipartBody) AddFile(name, filename string, reader io.Reader) *MultipartBody {
+	return b.AddPart(&MultipartPart{
+		Name:     name,
+		Filename: filename,
+		Reader:   reader,
+	})
+}
+
+// AddFileFromPath adds the file of the path, the file is opened when it is sent
+func (b *MultipartBody) AddFileFromPath(name, path string) *MultipartBody {
+	return b.AddPart(&MultipartPart{
+		Name: name,
+		Path: path,
+	})
+}
+
+// AddJSON adds the field of JSON encoded value, with the content type application/json
+func (b *MultipartBody) AddJSON(name string, value interface{}) *MultipartBody {
+	data, err := json.Marshal(value)
+	if err != nil {
+		b.setError(fmt.Errorf("%w: failed to encode json field(%s): %s", ErrInvalidBodyMultipart, name, err))
+		return b
+	}
+
+	return b.AddPart(&MultipartPart{
+		Name:        name,
+		ContentType: "application/json",
+		Value:       string(data),
+	})
+}
+
+// AddPart adds the part, which has the full control of filename, content type and headers
+func (b *MultipartBody) AddPart(part *MultipartPart) *MultipartBody {
+	b.parts = append(b.parts, part)
+	return b
+}
+
+func (b *MultipartBody) setError(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// build creates the parts to send
+func (b *MultipartBody) build() ([]*multipartPart, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	parts := make([]*multipartPart, 0, len(b.parts))
+	for _, p := range b.parts {
+		part, err := p.build()
+		if err != nil {
+			closeMultipartParts(parts)
+			return nil, err
+		}
+
+		parts = append(parts, part)
+	}
+
+	return parts, nil
+}
+
+func (p *MultipartPart) build() (*multipartPart, error) {
+	filename := p.Filename
+	contentType := p.ContentType
+	part := &multipartPart{}
+
+	switch {
+	case p.Path != "":
+		info, err := os.Stat(p.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart file(%s): %w", p.Name, err)
+		}
+
+		if filename == "" {
+			filename = filepath.Base(p.Path)
+		}
+		if contentType == "" {
+			// the header is known before opening the file, for the content length
+			if contentType = mime.TypeByExtension(filepath.Ext(p.Path)); contentType == "" {
+				contentType = "application/octet-stream"
+			}
+		}
+
+		path := p.Path
+		part.open = func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}
+		part.size = -1
+		if info.Mode().IsRegular() {
+			part.size = info.Size()
+		}
+	case p.Reader != nil:
+		if f, ok := p.Reader.(interface{ Name() string }); ok && filename == "" {
+			// the local directory is not sent, like browsers
+			filename = filepath.Base(f.Name())
+		}
+
+		// the size must be known before sniffing, which consumes the reader
+		part.size = readerSize(p.Reader)
+		part.reader = p.Reader
+		if contentType == "" {
+			buffered := bufio.NewReaderSize(p.Reader, sniffLen)
+			head, err := buffered.Peek(sniffLen)
+			if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+				return nil, fmt.Errorf("failed to read multipart file(%s): %w", p.Name, err)
+			}
+
+			contentType = http.DetectContentType(head)
+			part.reader = &multipartFileReader{Reader: buffered, file: p.Reader}
+		}
+	default:
+		part.reader = strings.NewReader(p.Value)
+		part.size = int64(len(p.Value))
+	}
+
+	h := make(textproto.MIMEHeader)
+	if filename == "" {
+		h.Set("Content-Disposition",
+			fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(p.Name)))
+	} else {
+		h.Set("Content-Disposition",
+			fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+				escapeQuotes(p.Name), escapeQuotes(filename)))
+	}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	for k, v := range p.Headers {
+		h.Set(k, v)
+	}
+
+	part.header = h
+	return part, nil
+}
+
+// replayable reports whether the parts can be built again to replay the body,
+//
+//	the paths are opened again, while the readers are consumed by sending.
+func (b *MultipartBody) replayable() bool {
+	for _, part := range b.parts {
+		if part.Path == "" && part.Reader != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// multipartBodyOf creates the body of the map, ordered by the field name,
+//
+//	the value is string, bool, number, []string (repeated), io.Reader (file) or *MultipartPart.
+func multipartBodyOf(values map[string]interface{}) *MultipartBody {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	body := NewMultipartBody()
+	for _, k := range keys {
+		switch v := values[k].(type) {
+		case nil:
+		case io.Reader:
+			body.AddFile(k, "", v)
+		case []string:
+			for _, value := range v {
+				body.AddField(k, value)
+			}
+		case *MultipartPart:
+			part := *v
+			if part.Name == "" {
+				part.Name = k
+			}
+			body.AddPart(&part)
+		default:
+			body.AddField(k, v)
+		}
+	}
+
+	return body
+}
+
+// multipartError wraps the error of building the parts with ErrInvalidBodyMultipart,
+//
+//	like the missing file of path.
+func multipartError(err error) error {
+	if errors.Is(err, ErrInvalidBodyMultipart) {
+		return err
+	}
+
+	return newError(ErrInvalidBodyMultipart, ErrInvalidBodyMultipart.Error()+": "+err.Error(), err)
+}
+
+func formatMultipartValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case interface{ String() string }:
+		return v.String(), true
+	}
+
+	return "", false
+}
+
+// multipartPart is a part to send
+type multipartPart struct {
+	header textproto.MIMEHeader
+	reader io.Reader
+	// open opens the content lazily when the part is sent, like the file of path
+	open func() (io.ReadCloser, error)
+	// size is the length of the part content, -1 means unknown
+	size int64
+}
+
+// multipartBody is the streaming multipart/form-data body,
+//
+//	the parts are written to the pipe when the body is read,
+//	so that the large files are never buffered in memory.
+type multipartBody struct {
+	parts    []*multipartPart
+	boundary string
+
+	once   sync.Once
+	reader *io.PipeReader
+	writer *io.PipeWriter
+}
+
+func newMultipartBody(parts []*multipartPart) *multipartBody {
+	reader, writer := io.Pipe()
+	return &multipartBody{
+		parts:    parts,
+		boundary: multipart.NewWriter(nil).Boundary(),
+		reader:   reader,
+		writer:   writer,
+	}
+}
+
+// replay returns the body of the rebuilt parts, with the same boundary of the content type
+func (b *multipartBody) replay(parts []*multipartPart) *multipartBody {
+	body := newMultipartBody(parts)
+	body.boundary = b.boundary
+	return body
+}
+
+// multipartFileReader reads the sniffed file, and closes the original file
+type multipartFileReader struct {
+	*bufio.Reader
+	file io.Reader
+}
+
+func (r *multipartFileReader) Close() error {
+	if closer, ok := r.file.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// ContentType returns the content type with the boundary
+func (b *multipartBody) ContentType() string {
+	return "multipart/form-data; boundary=" + b.boundary
+}
+
+// ContentLength returns the length of the body, -1 means unknown (chunked)
+func (b *multipartBody) ContentLength() int64 {
+	var counter writeCounter
+	w := multipart.NewWriter(&counter)
+	if err := w.SetBoundary(b.boundary); err != nil {
+		return -1
+	}
+
+	for _, part := range b.parts {
+		if part.size < 0 {
+			return -1
+		}
+
+		if _, err := w.CreatePart(part.header); err != nil {
+			return -1
+		}
+		counter += writeCounter(part.size)
+	}
+
+	if err := w.Close(); err != nil {
+		return -1
+	}
+
+	return int64(counter)
+}
+
+// Read starts writing the parts to the pipe at the first read
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		go b.write()
+	})
+
+	return b.reader.Read(p)
+}
+
+// Close closes the body and the files
+func (b *multipartBody) Close() error {
+	b.once.Do(func() {
+		// never read, so nothing is written
+		closeMultipartParts(b.parts)
+	})
+
+	return b.reader.Close()
+}
+
+func (b *multipartBody) write() {
+	defer closeMultipartParts(b.parts)
+
+	w := multipart.NewWriter(b.writer)
+	if err := w.SetBoundary(b.boundary); err != nil {
+		b.writer.CloseWithError(err)
+		return
+	}
+
+	for _, part := range b.parts {
+		pw, err := w.CreatePart(part.header)
+		if err != nil {
+			b.writer.CloseWithError(err)
+			return
+		}
+
+		if err := part.writeTo(pw); err != nil {
+			b.writer.CloseWithError(err)
+			return
+		}
+	}
+
+	b.writer.CloseWithError(w.Close())
+}
+
+func (p *multipartPart) writeTo(w io.Writer) error {
+	if p.open == nil {
+		_, err := io.Copy(w, p.reader)
+		return err
+	}
+
+	reader, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+func closeMultipartParts(parts []*multipartPart) {
+	for _, part := range parts {
+		if closer, ok := part.reader.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// readerSize returns the remaining length of the reader, -1 means unknown
+func readerSize(reader io.Reader) int64 {
+	switch v := reader.(type) {
+	case interface{ Len() int }:
+		// bytes.Reader, bytes.Buffer, strings.Reader
+		return int64(v.Len())
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+
+		return info.Size() - offset
+	case *namedReadCloser:
+		return readerSize(v.reader)
+	}
+
+	return -1
+}
+
+// writeCounter counts the written bytes
+type writeCounter int64
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	*c += writeCounter(len(p))
+	return len(p), nil
+}
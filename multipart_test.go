@@ -0,0 +1,324 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+// newMultipartServer responds the parts as name|filename|content-type|sha256|size[|x-meta], and the content length
+func newMultipartServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var lines []string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			hash := sha256.New()
+			n, _ := io.Copy(hash, part)
+			fields := []string{
+				part.FormName(),
+				part.FileName(),
+				part.Header.Get("Content-Type"),
+				hex.EncodeToString(hash.Sum(nil)),
+				strconv.FormatInt(n, 10),
+			}
+			if meta := part.Header.Get("X-Meta"); meta != "" {
+				fields = append(fields, meta)
+			}
+			lines = append(lines, strings.Join(fields, "|"))
+		}
+
+		w.Header().Set("X-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+		w.Write([]byte(strings.Join(lines, "\n")))
+	}))
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func TestMultipartStreamingFile(t *testing.T) {
+	server := newMultipartServer()
+	defer server.Close()
+
+	// a png header, followed by 4 MB data
+	data := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), bytes.Repeat([]byte("0123456789abcdef"), 256*1024)...)
+	path := filepath.Join(t.TempDir(), "image.png")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	var last, lastTotal int64
+	response, err := New().
+		SetProgressCallback(func(percent, current, total int64) {
+			calls++
+			last = current
+			lastTotal = total
+			testify.Assert(t, percent >= 0 && percent <= 100, "invalid percent")
+		}).
+		Post(server.URL, &Config{
+			Headers: Headers{"Content-Type": "multipart/form-data"},
+			Body: map[string]interface{}{
+				"file": file,
+				"name": "image",
+			},
+		}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, strings.Join([]string{
+		"file|image.png|image/png|" + sha256Hex(data) + "|" + strconv.Itoa(len(data)),
+		"name|||" + sha256Hex([]byte("image")) + "|5",
+	}, "\n"), response.String())
+	testify.Assert(t, calls > 1, "expected the progress events")
+	testify.Equal(t, lastTotal, last)
+	testify.Equal(t, strconv.FormatInt(lastTotal, 10), response.Headers.Get("X-Content-Length"))
+
+	// the file is closed after uploading
+	_, err = file.Read(make([]byte, 1))
+	testify.Assert(t, err != nil, "expected the file is closed")
+}
+
+func TestMultipartContentLength(t *testing.T) {
+	server := newMultipartServer()
+	defer server.Close()
+
+	// the sizes of bytes.Reader and strings are known
+	response, err := Post(server.URL, &Config{
+		Headers: Headers{"Content-Type": "multipart/form-data"},
+		Body: map[string]interface{}{
+			"file":  CreateNamedReader("hello.txt", bytes.NewReader([]byte("hello world"))),
+			"field": "value",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, strings.Join([]string{
+		"field|||" + sha256Hex([]byte("value")) + "|5",
+		"file|hello.txt|text/plain; charset=utf-8|" + sha256Hex([]byte("hello world")) + "|11",
+	}, "\n"), response.String())
+	testify.Assert(t, response.Headers.Get("X-Content-Length") != "-1", "expected the content length")
+
+	// the size of the pipe is unknown, so the body is chunked
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte("%PDF-1.4 streaming"))
+		writer.Close()
+	}()
+
+	response, err = Post(server.URL, &Config{
+		Headers: Headers{"Content-Type": "multipart/form-data"},
+		Body: map[string]interface{}{
+			"file": reader,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "file||application/pdf|"+sha256Hex([]byte("%PDF-1.4 streaming"))+"|18", response.String())
+	testify.Equal(t, "-1", response.Headers.Get("X-Content-Length"))
+}
+
+func TestUploadProgressWithRetry(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var events []int64
+	response, err := New().
+		SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond, RetryNonIdempotent: true}).
+		SetProgressCallback(func(percent, current, total int64) {
+			if current == total {
+				events = append(events, percent)
+			}
+		}).
+		Post(server.URL, &Config{
+			Headers: Headers{"Content-Type": "application/octet-stream"},
+			Body:    []byte("upload body"),
+		}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "ok", response.String())
+
+	// every attempt reports from the beginning
+	testify.Equal(t, 2, len(events))
+	testify.Equal(t, int64(100), events[0])
+	testify.Equal(t, int64(100), events[1])
+}
+
+func TestMultipartBody(t *testing.T) {
+	server := newMultipartServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path, []byte(`{"a":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	body := NewMultipartBody().
+		AddField("tags[]", "a", "b").
+		AddField("count", 3).
+		AddField("enabled", true).
+		AddFileFromPath("file", path).
+		AddJSON("meta", map[string]string{"k": "v"}).
+		AddPart(&MultipartPart{
+			Name:        "raw",
+			Filename:    "raw.bin",
+			ContentType: "application/x-custom",
+			Headers:     Headers{"X-Meta": "custom"},
+			Reader:      strings.NewReader("raw"),
+		})
+
+	// the content type is multipart/form-data for MultipartBody
+	response, err := Post(server.URL, &Config{Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"tags[]|||" + sha256Hex([]byte("a")) + "|1",
+		"tags[]|||" + sha256Hex([]byte("b")) + "|1",
+		"count|||" + sha256Hex([]byte("3")) + "|1",
+		"enabled|||" + sha256Hex([]byte("true")) + "|4",
+		"file|data.json|application/json|" + sha256Hex([]byte(`{"a":1}`)) + "|7",
+		"meta||application/json|" + sha256Hex([]byte(`{"k":"v"}`)) + "|9",
+		"raw|raw.bin|application/x-custom|" + sha256Hex([]byte("raw")) + "|3|custom",
+	}, "\n")
+	testify.Equal(t, expected, response.String())
+	testify.Assert(t, response.Headers.Get("X-Content-Length") != "-1", "expected the content length")
+
+	// the file of path is opened lazily, so it is sent with the latest content
+	if err := os.WriteFile(path, []byte(`{"a":2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	response, err = Post(server.URL, &Config{Body: NewMultipartBody().AddFileFromPath("file", path)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "file|data.json|application/json|"+sha256Hex([]byte(`{"a":2}`))+"|7", response.String())
+
+	_, err = Post(server.URL, &Config{Body: NewMultipartBody().AddFileFromPath("file", path+".missing")})
+	testify.Assert(t, errors.Is(err, os.ErrNotExist), "expected the missing file")
+
+	_, err = Post(server.URL, &Config{Body: NewMultipartBody().AddField("invalid", struct{}{})})
+	testify.Assert(t, errors.Is(err, ErrInvalidBodyMultipart), "expected ErrInvalidBodyMultipart")
+}
+
+func TestMultipartMapValues(t *testing.T) {
+	server := newMultipartServer()
+	defer server.Close()
+
+	response, err := Post(server.URL, &Config{
+		Headers: Headers{"Content-Type": "multipart/form-data"},
+		Body: map[string]interface{}{
+			"b":    []string{"1", "2"},
+			"a":    1.5,
+			"file": &MultipartPart{Filename: "a.txt", Value: "text"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, strings.Join([]string{
+		"a|||" + sha256Hex([]byte("1.5")) + "|3",
+		"b|||" + sha256Hex([]byte("1")) + "|1",
+		"b|||" + sha256Hex([]byte("2")) + "|1",
+		"file|a.txt||" + sha256Hex([]byte("text")) + "|4",
+	}, "\n"), response.String())
+}
+
+func TestMultipartRetry(t *testing.T) {
+	server, count := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "retry.txt")
+	if err := os.WriteFile(path, []byte("file content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond}
+
+	// the parts of paths and values are built again for the retry
+	response, err := Put(server.URL, &Config{
+		Headers:     Headers{"Content-Type": "multipart/form-data"},
+		Body:        NewMultipartBody().AddFileFromPath("file", path).AddField("name", "retry"),
+		RetryPolicy: policy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusOK, response.Status)
+	testify.Equal(t, 2, response.Attempts)
+	testify.Equal(t, int32(2), atomic.LoadInt32(count))
+	testify.Assert(t, strings.Contains(response.String(), "file content"), "expected the file in the retry")
+	testify.Assert(t, strings.Contains(response.String(), "retry"), "expected the field in the retry")
+
+	// the reader is not buffered, so the retry is skipped
+	server, count = newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte("streaming"))
+		writer.Close()
+	}()
+
+	response, err = Put(server.URL, &Config{
+		Headers:     Headers{"Content-Type": "multipart/form-data"},
+		Body:        map[string]interface{}{"file": reader},
+		RetryPolicy: policy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusServiceUnavailable, response.Status)
+	testify.Equal(t, 1, response.Attempts)
+	testify.Equal(t, int32(1), atomic.LoadInt32(count))
+}
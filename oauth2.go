@@ -0,0 +1,356 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"github.com/go-zoox/headers"
+)
+
+// OAuth2 grant types
+const (
+	OAuth2GrantClientCredentials = "client_credentials"
+	OAuth2GrantRefreshToken      = "refresh_token"
+	OAuth2GrantPassword          = "password"
+	OAuth2GrantJWTBearer         = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// DefaultOAuth2ExpiryDelta is how long before the expiry the token is refreshed
+var DefaultOAuth2ExpiryDelta = 30 * time.Second
+
+// DefaultOAuth2TokenTimeout is the timeout of the token request, if the request to authorize has no timeout
+var DefaultOAuth2TokenTimeout = 30 * time.Second
+
+// OAuth2Config is the OAuth2 client config
+type OAuth2Config struct {
+	// TokenURL is the token endpoint
+	TokenURL string
+	// GrantType is the grant to acquire the token, default client_credentials
+	GrantType string
+	//
+	ClientID     string
+	ClientSecret string
+	// AuthInParams sends the client credentials in the request body,
+	//	instead of the basic auth header (client_secret_basic)
+	AuthInParams bool
+	//
+	Scopes []string
+	// Username and Password are used by the password grant
+	Username string
+	Password string
+	// RefreshToken is used by the refresh_token grant
+	RefreshToken string
+	// Assertion returns the signed JWT of the jwt-bearer grant
+	Assertion func() (string, error) `json:"-"`
+	// EndpointParams are the extra params to the token endpoint, like audience
+	EndpointParams map[string]string
+	// ExpiryDelta is how long before the expiry the token is refreshed, zero means DefaultOAuth2ExpiryDelta
+	ExpiryDelta time.Duration
+}
+
+// OAuth2Token is the token from the token endpoint
+type OAuth2Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresIn    int64     `json:"expires_in,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// Authorization returns the Authorization header value of the token
+func (t *OAuth2Token) Authorization() string {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	return tokenType + " " + t.AccessToken
+}
+
+// valid reports whether the token is usable, zero expiry means never expires
+func (t *OAuth2Token) valid(delta time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+
+	return t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry)
+}
+
+// OAuth2TokenSource acquires and caches the OAuth2 token,
+//
+//	concurrent refreshes are merged into one token request.
+//	it is safe for concurrent use, and shared by the clones.
+type OAuth2TokenSource struct {
+	config *OAuth2Config
+	//
+	sync.Mutex
+	token    *OAuth2Token
+	inflight *oauth2Call
+}
+
+type oauth2Call struct {
+	done  chan struct{}
+	token *OAuth2Token
+	err   error
+}
+
+// NewOAuth2TokenSource creates an OAuth2 token source
+func NewOAuth2TokenSource(cfg *OAuth2Config) *OAuth2TokenSource {
+	return &OAuth2TokenSource{
+		config: cfg,
+	}
+}
+
+// SetOAuth2 sets the OAuth2 client, the token is acquired and refreshed automatically
+func (f *Fetch) SetOAuth2(cfg *OAuth2Config) *Fetch {
+	return f.SetOAuth2TokenSource(NewOAuth2TokenSource(cfg))
+}
+
+// SetOAuth2TokenSource sets the OAuth2 token source, which can be shared by fetches
+func (f *Fetch) SetOAuth2TokenSource(source *OAuth2TokenSource) *Fetch {
+	f.config.OAuth2 = source
+	return f
+}
+
+// SetToken sets the token, like the token restored from storage
+func (s *OAuth2TokenSource) SetToken(token *OAuth2Token) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.token = token
+}
+
+// Token returns the cached token, or acquires a new one if it is expired
+func (s *OAuth2TokenSource) Token(ctx context.Context) (*OAuth2Token, error) {
+	return s.getToken(ctx, nil)
+}
+
+// invalidate drops the token rejected by the server, and acquires a new one,
+//
+//	if the token has been refreshed by others, the new one is returned directly.
+func (s *OAuth2TokenSource) invalidate(ctx context.Context, rejected *OAuth2Token) (*OAuth2Token, error) {
+	return s.getToken(ctx, rejected)
+}
+
+func (s *OAuth2TokenSource) getToken(ctx context.Context, rejected *OAuth2Token) (*OAuth2Token, error) {
+	delta := s.config.ExpiryDelta
+	if delta == 0 {
+		delta = DefaultOAuth2ExpiryDelta
+	}
+
+	s.Lock()
+	if s.token != nil && s.token == rejected {
+		// keep the refresh token for the next token request
+		s.token = &OAuth2Token{RefreshToken: rejected.RefreshToken}
+	}
+
+	if s.token.valid(delta) {
+		token := s.token
+		s.Unlock()
+		return token, nil
+	}
+
+	call := s.inflight
+	if call == nil {
+		call = &oauth2Call{done: make(chan struct{})}
+		s.inflight = call
+
+		var refreshToken string
+		if s.token != nil {
+			refreshToken = s.token.RefreshToken
+		}
+		s.Unlock()
+
+		// the token request is shared by the callers, so it is not canceled with the caller who starts it,
+		//	nor traced as the request of the caller
+		go func(ctx context.Context) {
+			call.token, call.err = s.retrieve(ctx, refreshToken)
+
+			s.Lock()
+			if call.err == nil {
+				s.token = call.token
+			}
+			s.inflight = nil
+			s.Unlock()
+			close(call.done)
+		}(withoutClientTrace(withoutCancel(ctx)))
+	} else {
+		s.Unlock()
+	}
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// retrieve requests the token endpoint,
+//
+//	the refresh token is preferred, and falls back to the configured grant if it is rejected.
+func (s *OAuth2TokenSource) retrieve(ctx context.Context, refreshToken string) (*OAuth2Token, error) {
+	if refreshToken == "" {
+		refreshToken = s.config.RefreshToken
+	}
+
+	grantType := s.config.GrantType
+	if grantType == "" {
+		grantType = OAuth2GrantClientCredentials
+	}
+
+	if refreshToken != "" {
+		token, err := s.request(ctx, map[string]string{
+			"grant_type":    OAuth2GrantRefreshToken,
+			"refresh_token": refreshToken,
+		})
+		if err == nil || grantType == OAuth2GrantRefreshToken {
+			if token != nil && token.RefreshToken == "" {
+				token.RefreshToken = refreshToken
+			}
+
+			return token, err
+		}
+	}
+
+	params := map[string]string{
+		"grant_type": grantType,
+	}
+
+	switch grantType {
+	case OAuth2GrantClientCredentials:
+	case OAuth2GrantPassword:
+		params["username"] = s.config.Username
+		params["password"] = s.config.Password
+	case OAuth2GrantJWTBearer:
+		if s.config.Assertion == nil {
+			return nil, fmt.Errorf("%w: assertion is required by jwt-bearer grant", ErrOAuth2TokenFailed)
+		}
+
+		assertion, err := s.config.Assertion()
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to create assertion: %v", ErrOAuth2TokenFailed, err)
+		}
+		params["assertion"] = assertion
+	case OAuth2GrantRefreshToken:
+		return nil, fmt.Errorf("%w: refresh token is required by refresh_token grant", ErrOAuth2TokenFailed)
+	}
+
+	return s.request(ctx, params)
+}
+
+func (s *OAuth2TokenSource) request(ctx context.Context, params map[string]string) (*OAuth2Token, error) {
+	if len(s.config.Scopes) != 0 {
+		params["scope"] = strings.Join(s.config.Scopes, " ")
+	}
+
+	for k, v := range s.config.EndpointParams {
+		params[k] = v
+	}
+
+	// the token request is sent with the connection settings of the request to authorize
+	f := New().SetContext(ctx).
+		inheritTransport(ctx).
+		SetContentType("application/x-www-form-urlencoded").
+		SetAccept("application/json")
+	if f.config.Timeout == 0 {
+		f.config.Timeout = DefaultOAuth2TokenTimeout
+	}
+
+	if s.config.AuthInParams {
+		params["client_id"] = s.config.ClientID
+		if s.config.ClientSecret != "" {
+			params["client_secret"] = s.config.ClientSecret
+		}
+	} else if s.config.ClientID != "" {
+		// RFC 6749 section 2.3.1, the client credentials are form encoded first
+		f.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+	}
+
+	response, err := f.Post(s.config.TokenURL, &Config{Body: params}).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuth2TokenFailed, err)
+	}
+
+	if !response.Ok() {
+		if e := response.Get("error").String(); e != "" {
+			return nil, fmt.Errorf("%w: %s %s", ErrOAuth2TokenFailed, e, response.Get("error_description").String())
+		}
+
+		return nil, fmt.Errorf("%w: status %d", ErrOAuth2TokenFailed, response.Status)
+	}
+
+	token := &OAuth2Token{}
+	if err := json.Unmarshal(response.Body, token); err != nil {
+		return nil, fmt.Errorf("%w: invalid token response: %v", ErrOAuth2TokenFailed, err)
+	}
+
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: access_token is empty", ErrOAuth2TokenFailed)
+	}
+
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+// oauth2Transport authorizes the request with the OAuth2 token,
+//
+//	and refreshes the token and retries once on 401.
+type oauth2Transport struct {
+	source *OAuth2TokenSource
+	next   http.RoundTripper
+	// forwardAuthorization attaches the token to the cross origin redirects, see RedirectPolicy
+	forwardAuthorization bool
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *oauth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the token is only for the origin of the request, not the redirected third-party hosts
+	if initial := initialRequest(req); initial != req && isCrossOriginRedirect(initial, req) && !t.forwardAuthorization {
+		return t.next.RoundTrip(req)
+	}
+
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(cloneRequestWithHeader(req, headers.Authorization, token.Authorization()))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// the body cannot be replayed
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	token, err = t.source.invalidate(req.Context(), token)
+	if err != nil {
+		// the 401 response is more meaningful than the token error
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	retry := cloneRequestWithHeader(req, headers.Authorization, token.Authorization())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.next.RoundTrip(retry)
+}
@@ -0,0 +1,308 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+type tokenServer struct {
+	expiresIn int
+	issued    int32
+	grants    sync.Map
+	// revoked is the access token revoked by the resource server
+	revoked atomic.Value
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path == "/token" {
+		r.ParseForm()
+		clientID, clientSecret, ok := r.BasicAuth()
+		if ok {
+			// RFC 6749 section 2.3.1
+			clientID, _ = url.QueryUnescape(clientID)
+			clientSecret, _ = url.QueryUnescape(clientSecret)
+		} else {
+			clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+
+		if clientID != "client" || clientSecret != "secret:1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"bad client"}`))
+			return
+		}
+
+		grant := r.PostForm.Get("grant_type")
+		switch grant {
+		case OAuth2GrantPassword:
+			if r.PostForm.Get("username") != "user" || r.PostForm.Get("password") != "pass" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+		case OAuth2GrantJWTBearer:
+			if r.PostForm.Get("assertion") != "jwt" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+		case OAuth2GrantRefreshToken:
+			if r.PostForm.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+		}
+
+		// slow token endpoint, to merge the concurrent refreshes
+		time.Sleep(20 * time.Millisecond)
+
+		n := atomic.AddInt32(&s.issued, 1)
+		s.grants.Store(grant, true)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  fmt.Sprintf("token-%d", n),
+			"token_type":    "bearer",
+			"expires_in":    s.expiresIn,
+			"refresh_token": "refresh",
+			"scope":         r.PostForm.Get("scope"),
+		})
+		return
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer token-") || authorization == s.revoked.Load() {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Write([]byte(authorization))
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600}
+	server.revoked.Store("")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	f := Create(ts.URL).SetOAuth2(&OAuth2Config{
+		TokenURL:     ts.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "secret:1",
+		Scopes:       []string{"read", "write"},
+	})
+
+	// concurrent requests share one token request
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := f.Clone().Get("/api").Execute()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			testify.Equal(t, "Bearer token-1", response.String())
+		}()
+	}
+	wg.Wait()
+	testify.Equal(t, int32(1), atomic.LoadInt32(&server.issued))
+
+	// refresh on 401, and retry once
+	server.revoked.Store("Bearer token-1")
+	response, err := f.Clone().Post("/api", &Config{Body: map[string]string{"a": "b"}}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "Bearer token-2", response.String())
+	_, refreshed := server.grants.Load(OAuth2GrantRefreshToken)
+	testify.Assert(t, refreshed, "Expected refresh_token grant")
+}
+
+func TestOAuth2TokenRequestTLS(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600}
+	server.revoked.Store("")
+	ts := httptest.NewTLSServer(server)
+	defer ts.Close()
+
+	// the token request trusts the ca of the request to authorize
+	response, err := Get(ts.URL+"/api", &Config{
+		TLSCaCert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}),
+		OAuth2: NewOAuth2TokenSource(&OAuth2Config{
+			TokenURL:     ts.URL + "/token",
+			ClientID:     "client",
+			ClientSecret: "secret:1",
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "Bearer token-1", response.String())
+}
+
+func TestOAuth2CrossOriginRedirect(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600}
+	server.revoked.Store("")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	third := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("third:" + r.Header.Get("Authorization")))
+	}))
+	defer third.Close()
+
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/same" {
+			http.Redirect(w, r, "/echo", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/echo" {
+			w.Write([]byte("same:" + r.Header.Get("Authorization")))
+			return
+		}
+
+		http.Redirect(w, r, third.URL+"/", http.StatusFound)
+	}))
+	defer redirector.Close()
+
+	f := Create(redirector.URL).SetOAuth2(&OAuth2Config{
+		TokenURL:     ts.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "secret:1",
+	})
+
+	// the token is not leaked to the third-party host
+	response, err := f.Clone().Get("/cross").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "third:", response.String())
+
+	response, err = f.Clone().Get("/same").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "same:Bearer token-1", response.String())
+
+	response, err = f.Clone().
+		SetRedirectPolicy(&RedirectPolicy{ForwardAuthorization: true}).
+		Get("/cross").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "third:Bearer token-1", response.String())
+}
+
+func TestOAuth2Expiry(t *testing.T) {
+	server := &tokenServer{expiresIn: 1}
+	server.revoked.Store("")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	source := NewOAuth2TokenSource(&OAuth2Config{
+		TokenURL:     ts.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "secret:1",
+		AuthInParams: true,
+		ExpiryDelta:  time.Second,
+	})
+
+	// expires within the expiry delta, so every call acquires a new token
+	for i := 1; i <= 2; i++ {
+		token, err := source.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, fmt.Sprintf("token-%d", i), token.AccessToken)
+	}
+}
+
+func TestOAuth2CanceledCaller(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600}
+	server.revoked.Store("")
+
+	requested := make(chan struct{})
+	var once sync.Once
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(requested) })
+		server.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	source := NewOAuth2TokenSource(&OAuth2Config{
+		TokenURL:     ts.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "secret:1",
+	})
+
+	// the caller who starts the token request gives up before the token endpoint responds
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := source.Token(ctx)
+		testify.Assert(t, err == context.DeadlineExceeded, "expected the deadline exceeded")
+	}()
+
+	// the others still get the token of the shared token request
+	<-requested
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "token-1", token.AccessToken)
+	testify.Equal(t, int32(1), atomic.LoadInt32(&server.issued))
+	wg.Wait()
+}
+
+func TestOAuth2Grants(t *testing.T) {
+	server := &tokenServer{expiresIn: 3600}
+	server.revoked.Store("")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	configs := map[string]*OAuth2Config{
+		OAuth2GrantPassword:     {GrantType: OAuth2GrantPassword, Username: "user", Password: "pass"},
+		OAuth2GrantJWTBearer:    {GrantType: OAuth2GrantJWTBearer, Assertion: func() (string, error) { return "jwt", nil }},
+		OAuth2GrantRefreshToken: {GrantType: OAuth2GrantRefreshToken, RefreshToken: "refresh"},
+	}
+
+	for grant, cfg := range configs {
+		cfg.TokenURL = ts.URL + "/token"
+		cfg.ClientID = "client"
+		cfg.ClientSecret = "secret:1"
+
+		token, err := NewOAuth2TokenSource(cfg).Token(context.Background())
+		if err != nil {
+			t.Fatal(grant, err)
+		}
+		testify.Assert(t, strings.HasPrefix(token.Authorization(), "Bearer token-"))
+
+		_, ok := server.grants.Load(grant)
+		testify.Assert(t, ok, "Expected grant "+grant)
+	}
+
+	_, err := NewOAuth2TokenSource(&OAuth2Config{
+		TokenURL:     ts.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "wrong",
+	}).Token(context.Background())
+	testify.Assert(t, err != nil && strings.Contains(err.Error(), "invalid_client"))
+}
@@ -1,5 +1,10 @@
 package fetch
 
+import (
+	"io"
+	"net/http"
+)
+
 // inspired by:
 //	https://github.com/schollz/progressbar/blob/master/progressbar.go
 //  https://stackoverflow.com/questions/26050380/go-tracking-post-request-progress
@@ -15,6 +20,60 @@ type Progress struct {
 func (p *Progress) Write(b []byte) (n int, err error) {
 	n = len(b)
 	p.Current += int64(n)
-	p.Reporter(p.Current/p.Total, p.Current, p.Total)
+
+	// the total is unknown (-1) for the chunked body
+	var percent int64
+	if p.Total > 0 {
+		percent = p.Current * 100 / p.Total
+	}
+
+	p.Reporter(percent, p.Current, p.Total)
+	return
+}
+
+// progressReader reports the progress of reading the body
+type progressReader struct {
+	io.ReadCloser
+	progress *Progress
+}
+
+func (r *progressReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if n > 0 {
+		r.progress.Write(p[:n])
+	}
+
 	return
 }
+
+// withUploadProgress reports the progress of sending the request body,
+//
+//	every attempt (retry or redirect) reports from the beginning.
+func withUploadProgress(req *http.Request, reporter OnProgress) {
+	total := req.ContentLength
+	if total == 0 {
+		total = -1
+	}
+
+	wrap := func(body io.ReadCloser) io.ReadCloser {
+		return &progressReader{
+			ReadCloser: body,
+			progress: &Progress{
+				Total:    total,
+				Reporter: reporter,
+			},
+		}
+	}
+
+	req.Body = wrap(req.Body)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+
+			return wrap(body), nil
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package fetch
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyEnvironment uses the proxy of environment variables,
+//
+//	HTTP_PROXY, HTTPS_PROXY and NO_PROXY, which is the default.
+const ProxyEnvironment = "env"
+
+// ProxyDirect connects directly without proxy, even if the environment variables are set
+const ProxyDirect = "direct"
+
+// ProxyRule selects the proxy for the matched hosts
+type ProxyRule struct {
+	// Hosts are the patterns of the destination,
+	//	like example.com (and subdomains), .example.com (only subdomains), *.example.com,
+	//	api-*.example.com, example.com:8080, 10.0.0.0/8, 127.0.0.1 or * (all)
+	Hosts []string
+	// Proxy is the proxy url, or ProxyDirect, or ProxyEnvironment
+	Proxy string
+}
+
+// SetNoProxy sets the hosts which bypass the proxy, see ProxyRule.Hosts for the patterns,
+//
+//	NO_PROXY of environment variables is always applied.
+func (f *Fetch) SetNoProxy(hosts ...string) *Fetch {
+	f.config.NoProxy = hosts
+	return f
+}
+
+// AddProxyRule adds a proxy rule for the hosts, the first matched rule is used
+func (f *Fetch) AddProxyRule(proxy string, hosts ...string) *Fetch {
+	f.config.ProxyRules = append(append([]ProxyRule{}, f.config.ProxyRules...), ProxyRule{
+		Hosts: hosts,
+		Proxy: proxy,
+	})
+	return f
+}
+
+// SetProxyFunc sets the callback to select the proxy of each request, nil url means no proxy,
+//
+//	it takes precedence over Proxy, NoProxy and ProxyRules.
+func (f *Fetch) SetProxyFunc(fn func(req *http.Request) (*url.URL, error)) *Fetch {
+	f.config.ProxyFunc = fn
+	return f
+}
+
+// SetProxyAuth sets the credentials of the proxy, for HTTP (CONNECT) and SOCKS5 proxies
+func (f *Fetch) SetProxyAuth(username, password string) *Fetch {
+	f.config.ProxyAuth = BasicAuth{
+		Username: username,
+		Password: password,
+	}
+	return f
+}
+
+// SetProxyHeader sets the header to the proxy, like Proxy-Authorization,
+//
+//	it is sent in the CONNECT request for https, or in the request itself for http via HTTP proxy.
+func (f *Fetch) SetProxyHeader(key, value string) *Fetch {
+	if f.config.ProxyHeaders == nil {
+		f.config.ProxyHeaders = make(Headers)
+	}
+
+	f.config.ProxyHeaders[key] = value
+	return f
+}
+
+// proxySelector selects the proxy of each request by the config
+type proxySelector struct {
+	proxy   string
+	noProxy []string
+	rules   []ProxyRule
+	fn      func(req *http.Request) (*url.URL, error)
+	auth    BasicAuth
+	headers Headers
+
+	// selected is the proxy selected for the request, if fixed
+	selected *url.URL
+	fixed    bool
+}
+
+func newProxySelector(config *Config) *proxySelector {
+	return &proxySelector{
+		proxy:   config.Proxy,
+		noProxy: config.NoProxy,
+		rules:   config.ProxyRules,
+		fn:      config.ProxyFunc,
+		auth:    config.ProxyAuth,
+		headers: config.ProxyHeaders,
+	}
+}
+
+// Proxy returns the proxy of the request, nil means no proxy
+func (s *proxySelector) Proxy(req *http.Request) (*url.URL, error) {
+	if s.fixed {
+		return s.selected, nil
+	}
+
+	if s.fn != nil {
+		proxyURL, err := s.fn(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.withAuth(proxyURL), nil
+	}
+
+	for _, rule := range s.rules {
+		if matchHosts(rule.Hosts, req.URL) {
+			return s.resolve(rule.Proxy, req)
+		}
+	}
+
+	return s.resolve(s.proxy, req)
+}
+
+// resolve returns the proxy url of the proxy setting
+func (s *proxySelector) resolve(proxy string, req *http.Request) (*url.URL, error) {
+	switch proxy {
+	case ProxyDirect:
+		return nil, nil
+	case "", ProxyEnvironment:
+		// the environment variables are read every time, so that the changes take effect
+		proxyURL, err := httpproxy.FromEnvironment().ProxyFunc()(req.URL)
+		if err != nil || proxyURL == nil || matchHosts(s.noProxy, req.URL) {
+			return nil, err
+		}
+
+		return s.withAuth(proxyURL), nil
+	}
+
+	if matchHosts(s.noProxy, req.URL) || matchHosts(environmentNoProxy(), req.URL) {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %s", proxy)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupport proxy(%s)", proxy)
+	}
+
+	return s.withAuth(proxyURL), nil
+}
+
+// withAuth sets the credentials to the proxy url if it has no user info
+func (s *proxySelector) withAuth(proxyURL *url.URL) *url.URL {
+	if proxyURL == nil || proxyURL.User != nil || (s.auth.Username == "" && s.auth.Password == "") {
+		return proxyURL
+	}
+
+	u := *proxyURL
+	u.User = url.UserPassword(s.auth.Username, s.auth.Password)
+	return &u
+}
+
+// connectHeader returns the headers of the CONNECT request
+func (s *proxySelector) connectHeader() http.Header {
+	if len(s.headers) == 0 {
+		return nil
+	}
+
+	header := make(http.Header)
+	for key, value := range s.headers {
+		header.Set(key, value)
+	}
+
+	return header
+}
+
+// fix returns the selector which always selects the proxy, so that the request is sent as it is prepared
+func (s *proxySelector) fix(proxyURL *url.URL) *proxySelector {
+	selector := *s
+	selector.selected = proxyURL
+	selector.fixed = true
+	return &selector
+}
+
+type proxySelectorKey struct{}
+
+// withProxySelector returns the context which selects the proxy by the config
+func withProxySelector(ctx context.Context, config *Config) context.Context {
+	return context.WithValue(ctx, proxySelectorKey{}, newProxySelector(config))
+}
+
+// proxyFromContext is the proxy of transports,
+//
+//	the connections are pooled by the proxy, so the transports can be shared with different proxies.
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	if selector, ok := req.Context().Value(proxySelectorKey{}).(*proxySelector); ok {
+		return selector.Proxy(req)
+	}
+
+	return http.ProxyFromEnvironment(req)
+}
+
+// proxyConnectHeaderFromContext returns the headers of the CONNECT request
+func proxyConnectHeaderFromContext(ctx context.Context, proxyURL *url.URL, target string) (http.Header, error) {
+	if selector, ok := ctx.Value(proxySelectorKey{}).(*proxySelector); ok {
+		return selector.connectHeader(), nil
+	}
+
+	return nil, nil
+}
+
+// proxyHeaderTransport sets the proxy headers to the http request sent via HTTP proxy,
+//
+//	which has no CONNECT request, the request itself is sent to the proxy.
+type proxyHeaderTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *proxyHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	selector, ok := req.Context().Value(proxySelectorKey{}).(*proxySelector)
+	if !ok || len(selector.headers) == 0 || req.URL.Scheme != "http" {
+		return t.next.RoundTrip(req)
+	}
+
+	proxyURL, err := selector.Proxy(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// the proxy is selected once, so that the headers are never sent to another proxy or the target
+	req = req.Clone(context.WithValue(req.Context(), proxySelectorKey{}, selector.fix(proxyURL)))
+	if proxyURL != nil && (proxyURL.Scheme == "http" || proxyURL.Scheme == "https") {
+		for key, value := range selector.headers {
+			req.Header.Set(key, value)
+		}
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+func environmentNoProxy() []string {
+	value := os.Getenv("NO_PROXY")
+	if value == "" {
+		value = os.Getenv("no_proxy")
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// matchHosts reports whether the url matches any of the host patterns
+func matchHosts(patterns []string, u *url.URL) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https", "wss":
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+
+	for _, pattern := range patterns {
+		if matchHost(strings.ToLower(strings.TrimSpace(pattern)), host, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchHost(pattern, host, port string) bool {
+	switch {
+	case pattern == "":
+		return false
+	case pattern == "*":
+		return true
+	}
+
+	// CIDR, like 10.0.0.0/8
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		ip := net.ParseIP(host)
+		return ip != nil && network.Contains(ip)
+	}
+
+	// host:port
+	if h, p, err := net.SplitHostPort(pattern); err == nil {
+		if p != port {
+			return false
+		}
+
+		pattern = h
+	}
+
+	pattern = strings.Trim(pattern, "[]")
+	if ip := net.ParseIP(pattern); ip != nil {
+		return ip.Equal(net.ParseIP(host))
+	}
+
+	switch {
+	case strings.HasPrefix(pattern, "*."):
+		// subdomains only
+		return strings.HasSuffix(host, pattern[1:])
+	case strings.ContainsAny(pattern, "*?["):
+		matched, _ := path.Match(pattern, host)
+		return matched
+	case strings.HasPrefix(pattern, "."):
+		// subdomains only, like NO_PROXY
+		return strings.HasSuffix(host, pattern)
+	}
+
+	// the domain and its subdomains
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
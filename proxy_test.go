@@ -0,0 +1,412 @@
+package fetch
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-zoox/testify"
+)
+
+// upstreamAddr maps the domains to 127.0.0.1
+func upstreamAddr(addr string) string {
+	host, port, _ := net.SplitHostPort(addr)
+	if net.ParseIP(host) == nil {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+
+	return addr
+}
+
+// newProxyServer is the stand-in of http forward proxy, which supports CONNECT,
+//
+//	the Proxy-Authorization must be the authorization if it is not empty.
+func newProxyServer(authorization string, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if authorization != "" && r.Header.Get("Proxy-Authorization") != authorization {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method == http.MethodConnect {
+			upstream, err := net.Dial("tcp", upstreamAddr(r.Host))
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			conn, buffered, _ := w.(http.Hijacker).Hijack()
+			go func() {
+				io.Copy(upstream, buffered)
+				upstream.Close()
+			}()
+			io.Copy(conn, upstream)
+			conn.Close()
+			return
+		}
+
+		r.URL.Host = upstreamAddr(r.URL.Host)
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		for key, values := range resp.Header {
+			w.Header()[key] = values
+		}
+		w.Header().Set("X-Proxied", "true")
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+}
+
+// newSOCKS5Server is the stand-in of socks5 proxy with username/password auth (RFC 1928, RFC 1929)
+func newSOCKS5Server(t *testing.T, username, password string, hits *int32) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				atomic.AddInt32(hits, 1)
+
+				r := bufio.NewReader(conn)
+				header := make([]byte, 2)
+				io.ReadFull(r, header)
+				io.ReadFull(r, make([]byte, header[1]))
+				conn.Write([]byte{5, 2})
+
+				// username/password
+				io.ReadFull(r, header[:1])
+				user := readSOCKS5String(r)
+				pass := readSOCKS5String(r)
+				if user != username || pass != password {
+					conn.Write([]byte{1, 1})
+					return
+				}
+				conn.Write([]byte{1, 0})
+
+				request := make([]byte, 4)
+				io.ReadFull(r, request)
+				var host string
+				switch request[3] {
+				case 1:
+					ip := make([]byte, 4)
+					io.ReadFull(r, ip)
+					host = net.IP(ip).String()
+				case 3:
+					host = readSOCKS5String(r)
+				}
+				port := make([]byte, 2)
+				io.ReadFull(r, port)
+
+				upstream, err := net.Dial("tcp", upstreamAddr(net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))))
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(upstream, r)
+				io.Copy(conn, upstream)
+			}(conn)
+		}
+	}()
+
+	return listener
+}
+
+func readSOCKS5String(r io.Reader) string {
+	length := make([]byte, 1)
+	io.ReadFull(r, length)
+	value := make([]byte, length[0])
+	io.ReadFull(r, value)
+	return string(value)
+}
+
+func newEchoHostServer() (*httptest.Server, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	return server, port
+}
+
+func TestProxyAuth(t *testing.T) {
+	target, port := newEchoHostServer()
+	defer target.Close()
+
+	var hits int32
+	proxy := newProxyServer("Basic "+base64.StdEncoding.EncodeToString([]byte("user:p@ss")), &hits)
+	defer proxy.Close()
+
+	response, err := New().SetProxy(proxy.URL).Get("http://api.test:" + port + "/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusProxyAuthRequired, response.Status)
+
+	response, err = New().SetProxy(proxy.URL).SetProxyAuth("user", "p@ss").Get("http://api.test:" + port + "/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "api.test:"+port, response.String())
+	testify.Equal(t, "true", response.Headers.Get("X-Proxied"))
+}
+
+func TestProxyConnectWithTLS(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.ServerName))
+	}))
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+
+	var hits int32
+	proxy := newProxyServer("Bearer proxy-token", &hits)
+	defer proxy.Close()
+
+	// the tls settings are applied through the proxy
+	response, err := New().
+		SetProxy(proxy.URL).
+		SetProxyHeader("Proxy-Authorization", "Bearer proxy-token").
+		Get("https://example.com:"+port+"/", &Config{
+			TLSCaCert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: target.Certificate().Raw}),
+		}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "example.com", response.String())
+	testify.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	_, err = New().SetProxy(proxy.URL).Get("https://example.com:" + port + "/").Execute()
+	testify.Assert(t, err != nil, "expected the CONNECT is rejected")
+}
+
+func TestProxyHeader(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + "|" + r.Header.Get("Proxy-Authorization")))
+	}))
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+
+	tlsTarget := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.ServerName))
+	}))
+	defer tlsTarget.Close()
+	_, tlsPort, _ := net.SplitHostPort(tlsTarget.Listener.Addr().String())
+
+	var hits int32
+	proxy := newProxyServer("Bearer proxy-token", &hits)
+	defer proxy.Close()
+
+	f := New().SetProxy(proxy.URL).SetProxyHeader("Proxy-Authorization", "Bearer proxy-token")
+
+	// http is sent to the proxy with the headers
+	response, err := f.Clone().Get("http://api.test:" + port + "/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "api.test:"+port+"|", response.String())
+	testify.Equal(t, "true", response.Headers.Get("X-Proxied"))
+
+	// https is tunneled by the CONNECT request with the headers
+	response, err = f.Clone().Get("https://example.com:"+tlsPort+"/", &Config{
+		TLSCaCert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsTarget.Certificate().Raw}),
+	}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "example.com", response.String())
+	testify.Equal(t, int32(2), atomic.LoadInt32(&hits))
+
+	// the headers are not sent to the target without proxy
+	response, err = f.Clone().SetNoProxy("127.0.0.1").Get(target.URL).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "127.0.0.1:"+port+"|", response.String())
+	testify.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestNoProxy(t *testing.T) {
+	target, port := newEchoHostServer()
+	defer target.Close()
+
+	var hits int32
+	proxy := newProxyServer("", &hits)
+	defer proxy.Close()
+
+	f := New().SetProxy(proxy.URL)
+
+	response, err := f.Clone().SetNoProxy("10.0.0.0/8", "127.0.0.0/8").Get(target.URL).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "", response.Headers.Get("X-Proxied"))
+
+	response, err = f.Clone().SetNoProxy("*.internal").Get(target.URL).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "true", response.Headers.Get("X-Proxied"))
+
+	// NO_PROXY of environment variables is applied for the explicit proxy too
+	t.Setenv("NO_PROXY", "localhost,127.0.0.1:"+port)
+	response, err = f.Clone().Get(target.URL).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "", response.Headers.Get("X-Proxied"))
+	testify.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestProxyEnvironmentAndDirect(t *testing.T) {
+	target, port := newEchoHostServer()
+	defer target.Close()
+
+	var hits int32
+	proxy := newProxyServer("", &hits)
+	defer proxy.Close()
+
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "")
+
+	response, err := New().SetProxy(ProxyEnvironment).Get("http://env.test:" + port + "/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "true", response.Headers.Get("X-Proxied"))
+
+	response, err = New().
+		SetProxy(ProxyDirect).
+		SetHostOverride("env.test", "127.0.0.1").
+		Get("http://env.test:" + port + "/").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "", response.Headers.Get("X-Proxied"))
+	testify.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestProxyRulesAndFunc(t *testing.T) {
+	target, port := newEchoHostServer()
+	defer target.Close()
+
+	var hits int32
+	proxy := newProxyServer("", &hits)
+	defer proxy.Close()
+
+	f := New().
+		SetProxy(ProxyDirect).
+		AddProxyRule(proxy.URL, "*.test", "10.0.0.0/8").
+		AddProxyRule(ProxyDirect, "*")
+
+	response, err := f.Clone().Get("http://rule.test:" + port + "/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "true", response.Headers.Get("X-Proxied"))
+
+	response, err = f.Clone().Get(target.URL).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "", response.Headers.Get("X-Proxied"))
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	response, err = f.Clone().SetProxyFunc(func(req *http.Request) (*url.URL, error) {
+		if req.URL.Hostname() == "func.test" {
+			return proxyURL, nil
+		}
+
+		return nil, nil
+	}).Get("http://func.test:" + port + "/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "true", response.Headers.Get("X-Proxied"))
+	testify.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestSOCKS5ProxyAuth(t *testing.T) {
+	target, port := newEchoHostServer()
+	defer target.Close()
+
+	var hits int32
+	socks := newSOCKS5Server(t, "user", "secret", &hits)
+	defer socks.Close()
+
+	response, err := New().
+		SetProxy("socks5://"+socks.Addr().String()).
+		SetProxyAuth("user", "secret").
+		Get("http://socks.test:" + port + "/").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "socks.test:"+port, response.String())
+	testify.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	_, err = New().
+		SetProxy("socks5://"+socks.Addr().String()).
+		SetProxyAuth("user", "wrong").
+		Get("http://socks.test:" + port + "/").
+		Execute()
+	testify.Assert(t, err != nil, "expected socks5 auth failure")
+}
+
+func TestMatchHost(t *testing.T) {
+	cases := []struct {
+		pattern string
+		url     string
+		matched bool
+	}{
+		{"*", "http://example.com", true},
+		{"example.com", "http://example.com", true},
+		{"example.com", "http://api.example.com", true},
+		{"example.com", "http://notexample.com", false},
+		{".example.com", "http://example.com", false},
+		{".example.com", "http://api.example.com", true},
+		{"*.example.com", "http://api.example.com", true},
+		{"api-*.example.com", "http://api-v2.example.com", true},
+		{"api-*.example.com", "http://web.example.com", false},
+		{"example.com:8080", "http://example.com:8080", true},
+		{"example.com:8080", "http://example.com", false},
+		{"example.com:443", "https://example.com", true},
+		{"10.0.0.0/8", "http://10.1.2.3", true},
+		{"10.0.0.0/8", "http://192.168.1.1", false},
+		{"::1", "http://[::1]:8080", true},
+		{"127.0.0.1", "http://127.0.0.1:8080", true},
+	}
+
+	for _, c := range cases {
+		u, _ := url.Parse(c.url)
+		testify.Assert(t, matchHosts([]string{c.pattern}, u) == c.matched, c.pattern+" "+c.url)
+	}
+}
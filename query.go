@@ -0,0 +1,413 @@
+package fetch
+
+import (
+	"encoding"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-zoox/core-utils/fmt"
+)
+
+// ArrayFormat is the encoding style of slices in query and form body
+type ArrayFormat string
+
+const (
+	// ArrayFormatRepeat repeats the key, like a=1&a=2, which is the default
+	ArrayFormatRepeat ArrayFormat = "repeat"
+	// ArrayFormatComma joins the values by comma, like a=1,2
+	ArrayFormatComma ArrayFormat = "comma"
+	// ArrayFormatBrackets appends brackets to the key, like a[]=1&a[]=2
+	ArrayFormatBrackets ArrayFormat = "brackets"
+	// ArrayFormatIndices appends the indices to the key, like a[0]=1&a[1]=2
+	ArrayFormatIndices ArrayFormat = "indices"
+)
+
+// SetQueryObject sets the tagged struct or map which is encoded into the query,
+//
+//	see EncodeQuery for the encoding.
+func (f *Fetch) SetQueryObject(object interface{}) *Fetch {
+	f.config.QueryObject = object
+	return f
+}
+
+// SetArrayFormat sets the encoding style of slices in QueryObject and form body
+func (f *Fetch) SetArrayFormat(format ArrayFormat) *Fetch {
+	f.config.ArrayFormat = format
+	return f
+}
+
+// EncodeQuery encodes the struct or map into url values,
+//
+//	the field name is the `query:"name,omitempty"` tag, `query:"-"` is ignored,
+//	the nested structs and maps are encoded as a[b][c]=,
+//	time.Time and encoding.TextMarshaler are encoded as text.
+func EncodeQuery(v interface{}, format ArrayFormat) (url.Values, error) {
+	return encodeValues(v, format, "query")
+}
+
+// addConfigQuery adds the Query, QueryValues and QueryObject of the config to the query,
+//
+//	the empty values of Query and QueryValues are ignored.
+func addConfigQuery(query url.Values, config *Config) error {
+	for k, v := range config.Query {
+		if v != "" {
+			query.Add(k, v)
+		}
+	}
+
+	for k, values := range config.QueryValues {
+		for _, v := range values {
+			if v != "" {
+				query.Add(k, v)
+			}
+		}
+	}
+
+	if config.QueryObject != nil {
+		values, err := EncodeQuery(config.QueryObject, config.ArrayFormat)
+		if err != nil {
+			return fmt.Errorf("failed to encode query: %w", err)
+		}
+
+		for k, vs := range values {
+			query[k] = append(query[k], vs...)
+		}
+	}
+
+	return nil
+}
+
+// encodeValues encodes the value with the tags, the first found tag is used
+func encodeValues(v interface{}, format ArrayFormat, tags ...string) (url.Values, error) {
+	values := url.Values{}
+	if v == nil {
+		return values, nil
+	}
+
+	switch data := v.(type) {
+	case url.Values:
+		for key, vs := range data {
+			values[key] = append([]string{}, vs...)
+		}
+		return values, nil
+	case map[string]string:
+		for key, value := range data {
+			values.Add(key, value)
+		}
+		return values, nil
+	}
+
+	e := &valuesEncoder{
+		values: values,
+		format: format,
+		tags:   tags,
+	}
+
+	rv := indirectValue(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return values, nil
+	case reflect.Struct:
+		if err := e.encodeStruct("", rv); err != nil {
+			return nil, err
+		}
+	case reflect.Map:
+		if err := e.encodeMap("", rv); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %T, must be struct or map", v)
+	}
+
+	return values, nil
+}
+
+type valuesEncoder struct {
+	values url.Values
+	format ArrayFormat
+	tags   []string
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+func (e *valuesEncoder) encode(key string, v reflect.Value) error {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil
+	}
+
+	// time.Time is also a TextMarshaler
+	if text, ok, err := marshalText(v); ok {
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+
+		e.values.Add(key, text)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return e.encodeStruct(key, v)
+	case reflect.Map:
+		return e.encodeMap(key, v)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			e.values.Add(key, string(v.Bytes()))
+			return nil
+		}
+
+		return e.encodeSlice(key, v)
+	}
+
+	text, err := formatScalar(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+
+	e.values.Add(key, text)
+	return nil
+}
+
+func (e *valuesEncoder) encodeStruct(prefix string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// unexported
+			continue
+		}
+
+		name, omitempty := e.fieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		value := v.Field(i)
+		if omitempty && isEmptyValue(value) {
+			continue
+		}
+
+		// the embedded struct without name is flattened
+		if field.Anonymous && name == "" {
+			if embedded := indirectValue(value); embedded.Kind() == reflect.Struct {
+				if err := e.encodeStruct(prefix, embedded); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if err := e.encode(nestedKey(prefix, name), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *valuesEncoder) encodeMap(prefix string, v reflect.Value) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("unsupported map key type %s, must be string", v.Type().Key())
+	}
+
+	keys := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	// the order of keys is stable
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		if err := e.encode(nestedKey(prefix, key), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *valuesEncoder) encodeSlice(key string, v reflect.Value) error {
+	if e.format == ArrayFormatComma {
+		texts := make([]string, 0, v.Len())
+		nested := false
+		for i := 0; i < v.Len(); i++ {
+			text, ok, err := scalarText(v.Index(i))
+			if err != nil {
+				return fmt.Errorf("failed to encode %s: %w", key, err)
+			}
+			if !ok {
+				nested = true
+				break
+			}
+
+			texts = append(texts, text)
+		}
+
+		if !nested {
+			if len(texts) > 0 {
+				e.values.Add(key, strings.Join(texts, ","))
+			}
+			return nil
+		}
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+
+		itemKey := key
+		switch {
+		case e.format == ArrayFormatIndices || isNestedValue(item):
+			// the nested objects must be indexed, like a[0][b]=
+			itemKey = key + "[" + strconv.Itoa(i) + "]"
+		case e.format == ArrayFormatBrackets:
+			itemKey = key + "[]"
+		}
+
+		if err := e.encode(itemKey, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *valuesEncoder) fieldName(field reflect.StructField) (name string, omitempty bool) {
+	for _, tagName := range e.tags {
+		tag, ok := field.Tag.Lookup(tagName)
+		if !ok {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		for _, option := range parts[1:] {
+			if option == "omitempty" {
+				omitempty = true
+			}
+		}
+
+		return parts[0], omitempty
+	}
+
+	return "", false
+}
+
+func nestedKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "[" + key + "]"
+}
+
+// indirectValue dereferences the pointers and interfaces, invalid value means nil
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+
+		// the pointer receiver of TextMarshaler
+		if v.Kind() == reflect.Ptr && v.Type().Implements(textMarshalerType) {
+			return v
+		}
+
+		v = v.Elem()
+	}
+
+	return v
+}
+
+func marshalText(v reflect.Value) (string, bool, error) {
+	if !v.Type().Implements(textMarshalerType) {
+		if !v.CanAddr() || !reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+			return "", false, nil
+		}
+
+		v = v.Addr()
+	}
+
+	text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	return string(text), true, err
+}
+
+// scalarText returns the text of the scalar value, false means the value is nested
+func scalarText(v reflect.Value) (string, bool, error) {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return "", true, nil
+	}
+
+	if text, ok, err := marshalText(v); ok {
+		return text, true, err
+	}
+
+	if isNestedValue(v) {
+		return "", false, nil
+	}
+
+	text, err := formatScalar(v)
+	return text, true, err
+}
+
+func isNestedValue(v reflect.Value) bool {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return false
+	}
+
+	if _, ok, _ := marshalText(v); ok {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		return !(v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8)
+	}
+
+	return false
+}
+
+func formatScalar(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+
+	// like time.Time{}
+	return v.IsZero()
+}
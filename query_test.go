@@ -0,0 +1,124 @@
+package fetch
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+type queryFilter struct {
+	Status string `query:"status"`
+	Owner  string `query:"owner,omitempty"`
+}
+
+type queryPagination struct {
+	Page int `query:"page"`
+	Size int `query:"size,omitempty"`
+}
+
+type queryLevel int
+
+func (l queryLevel) MarshalText() ([]byte, error) {
+	return []byte([]string{"low", "high"}[l]), nil
+}
+
+type searchQuery struct {
+	queryPagination
+	Keyword string            `query:"q"`
+	Tags    []string          `query:"tags,omitempty"`
+	Filter  queryFilter       `query:"filter"`
+	Since   time.Time         `query:"since,omitempty"`
+	Level   queryLevel        `query:"level"`
+	Limit   *int              `query:"limit,omitempty"`
+	Extra   map[string]string `query:"extra,omitempty"`
+	Ignored string            `query:"-"`
+	Default bool
+}
+
+func TestEncodeQuery(t *testing.T) {
+	limit := 10
+	query := searchQuery{
+		queryPagination: queryPagination{Page: 2},
+		Keyword:         "go zoox",
+		Tags:            []string{"a", "b"},
+		Filter:          queryFilter{Status: "open"},
+		Since:           time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:           1,
+		Limit:           &limit,
+		Extra:           map[string]string{"y": "2", "x": "1"},
+		Ignored:         "ignored",
+	}
+
+	cases := []struct {
+		format   ArrayFormat
+		expected string
+	}{
+		{"", "Default=false&extra[x]=1&extra[y]=2&filter[status]=open&level=high&limit=10&page=2&q=go zoox&since=2024-01-02T03:04:05Z&tags=a&tags=b"},
+		{ArrayFormatComma, "Default=false&extra[x]=1&extra[y]=2&filter[status]=open&level=high&limit=10&page=2&q=go zoox&since=2024-01-02T03:04:05Z&tags=a,b"},
+		{ArrayFormatBrackets, "Default=false&extra[x]=1&extra[y]=2&filter[status]=open&level=high&limit=10&page=2&q=go zoox&since=2024-01-02T03:04:05Z&tags[]=a&tags[]=b"},
+		{ArrayFormatIndices, "Default=false&extra[x]=1&extra[y]=2&filter[status]=open&level=high&limit=10&page=2&q=go zoox&since=2024-01-02T03:04:05Z&tags[0]=a&tags[1]=b"},
+	}
+
+	for _, c := range cases {
+		values, err := EncodeQuery(&query, c.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, _ := url.QueryUnescape(values.Encode())
+		testify.Equal(t, c.expected, decoded)
+	}
+
+	// omitempty, and the nested objects in slices are indexed
+	values, err := EncodeQuery(map[string]interface{}{
+		"items": []queryFilter{{Status: "a"}, {Status: "b", Owner: "c"}},
+		"empty": nil,
+	}, ArrayFormatRepeat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := url.QueryUnescape(values.Encode())
+	testify.Equal(t, "items[0][status]=a&items[1][owner]=c&items[1][status]=b", decoded)
+
+	_, err = EncodeQuery("invalid", ArrayFormatRepeat)
+	testify.Assert(t, err != nil, "expected unsupported type")
+}
+
+func TestQueryObjectAndFormBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		decoded, _ := url.QueryUnescape(r.URL.RawQuery + "|" + string(body))
+		w.Write([]byte(decoded))
+	}))
+	defer server.Close()
+
+	response, err := Create(server.URL).
+		SetQuery("page", "1").
+		SetQueryObject(&queryFilter{Status: "open"}).
+		SetArrayFormat(ArrayFormatBrackets).
+		Post("/", &Config{
+			Headers: Headers{"Content-Type": "application/x-www-form-urlencoded"},
+			Body: struct {
+				Name string   `form:"name" query:"ignored"`
+				IDs  []int    `query:"ids"`
+				Skip []string `form:"skip,omitempty"`
+			}{Name: "zoox", IDs: []int{1, 2}},
+		}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "page=1&status=open|ids[]=1&ids[]=2&name=zoox", response.String())
+
+	_, err = Post(server.URL, &Config{
+		Headers: Headers{"Content-Type": "application/x-www-form-urlencoded"},
+		Body:    "invalid",
+	})
+	testify.Assert(t, errors.Is(err, ErrInvalidURLFormEncodedBody), "expected ErrInvalidURLFormEncodedBody")
+}
@@ -0,0 +1,314 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/headers"
+)
+
+// RateLimiterConfig is the config of rate limiter
+type RateLimiterConfig struct {
+	// RequestsPerSecond is the rate of token bucket, zero means unlimited
+	RequestsPerSecond float64
+	// Burst is the size of token bucket, zero means max(1, RequestsPerSecond)
+	Burst int
+	// MaxConcurrency is the maximum number of in-flight requests, zero means unlimited,
+	//	a request is in-flight until its response body is closed or fully read.
+	MaxConcurrency int
+	// PerHost applies the limits to each host separately,
+	//	otherwise all requests through the limiter share the limits.
+	PerHost bool
+	// Adaptive slows down automatically by the rate limit headers of responses,
+	//	like X-RateLimit-Remaining, X-RateLimit-Reset, RateLimit and Retry-After of 429.
+	Adaptive bool
+}
+
+// RateLimiter limits the rate and concurrency of requests,
+//
+//	it is safe for concurrent use, and can be shared across fetches.
+type RateLimiter struct {
+	cfg *RateLimiterConfig
+	//
+	sync.Mutex
+	limiters map[string]*limiter
+}
+
+// limiter is the token bucket and concurrency semaphore of a host (or all hosts)
+type limiter struct {
+	sync.Mutex
+	//
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	//
+	slots chan struct{}
+	// adaptive
+	pauseUntil time.Time
+	interval   time.Duration
+	next       time.Time
+}
+
+// NewRateLimiter creates a rate limiter
+func NewRateLimiter(cfg *RateLimiterConfig) *RateLimiter {
+	config := &RateLimiterConfig{}
+	if cfg != nil {
+		*config = *cfg
+	}
+
+	if config.Burst == 0 {
+		config.Burst = int(math.Max(1, math.Ceil(config.RequestsPerSecond)))
+	}
+
+	return &RateLimiter{
+		cfg:      config,
+		limiters: make(map[string]*limiter),
+	}
+}
+
+// SetRateLimiter sets the rate limiter, which is shared by the clones
+func (f *Fetch) SetRateLimiter(rl *RateLimiter) *Fetch {
+	f.config.RateLimiter = rl
+	return f
+}
+
+func (rl *RateLimiter) limiter(host string) *limiter {
+	if !rl.cfg.PerHost {
+		host = ""
+	}
+
+	rl.Lock()
+	defer rl.Unlock()
+
+	l, ok := rl.limiters[host]
+	if !ok {
+		l = &limiter{
+			rate:   rl.cfg.RequestsPerSecond,
+			burst:  float64(rl.cfg.Burst),
+			tokens: float64(rl.cfg.Burst),
+			last:   time.Now(),
+		}
+		if rl.cfg.MaxConcurrency > 0 {
+			l.slots = make(chan struct{}, rl.cfg.MaxConcurrency)
+		}
+
+		rl.limiters[host] = l
+	}
+
+	return l
+}
+
+// Wait waits until the request to host is allowed or the context is done,
+//
+//	release must be called when the request is finished.
+func (rl *RateLimiter) Wait(ctx context.Context, host string) (release func(), err error) {
+	l := rl.limiter(host)
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			if l.slots != nil {
+				<-l.slots
+			}
+		})
+	}
+
+	for {
+		wait := l.reserve(time.Now())
+		if wait <= 0 {
+			return release, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token if available, otherwise returns the duration to wait
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	if now.Before(l.pauseUntil) {
+		return l.pauseUntil.Sub(now)
+	}
+
+	if now.Before(l.next) {
+		return l.next.Sub(now)
+	}
+
+	if l.rate > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+
+		if l.tokens < 1 {
+			return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+
+		l.tokens--
+	}
+
+	if l.interval > 0 {
+		l.next = now.Add(l.interval)
+	}
+
+	return 0
+}
+
+// observe adapts the limiter by the rate limit headers of response
+func (l *limiter) observe(resp *http.Response, now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := parseRetryAfter(resp.Header.Get(headers.RetryAfter)); ok {
+			l.pauseUntil = now.Add(wait)
+			return
+		}
+	}
+
+	remaining, reset, ok := parseRateLimitHeaders(resp.Header, now)
+	if !ok {
+		return
+	}
+
+	if remaining <= 0 {
+		l.pauseUntil = now.Add(reset)
+		l.interval = 0
+		return
+	}
+
+	// spread the remaining requests over the reset window
+	l.interval = reset / time.Duration(remaining)
+}
+
+// parseRateLimitHeaders parses the remaining requests and the duration until reset,
+//
+//	supports X-RateLimit-*, RateLimit-* and RateLimit (IETF draft) headers.
+func parseRateLimitHeaders(h http.Header, now time.Time) (remaining int, reset time.Duration, ok bool) {
+	remainingValue := firstHeader(h, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	resetValue := firstHeader(h, "X-RateLimit-Reset", "RateLimit-Reset")
+
+	// RateLimit: limit=100, remaining=50, reset=30
+	// RateLimit: "default";r=50;t=30
+	if rateLimit := h.Get("RateLimit"); rateLimit != "" {
+		for _, part := range strings.FieldsFunc(rateLimit, func(r rune) bool { return r == ',' || r == ';' }) {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			switch strings.ToLower(kv[0]) {
+			case "remaining", "r":
+				remainingValue = kv[1]
+			case "reset", "t":
+				resetValue = kv[1]
+			}
+		}
+	}
+
+	if remainingValue == "" || resetValue == "" {
+		return 0, 0, false
+	}
+
+	remaining, err := strconv.Atoi(remainingValue)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	seconds, err := strconv.ParseInt(resetValue, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// unix timestamp, like GitHub X-RateLimit-Reset
+	if seconds > 1e9 {
+		reset = time.Unix(seconds, 0).Sub(now)
+	} else {
+		reset = time.Duration(seconds) * time.Second
+	}
+
+	if reset < 0 {
+		reset = 0
+	}
+
+	return remaining, reset, true
+}
+
+func firstHeader(h http.Header, keys ...string) string {
+	for _, key := range keys {
+		if v := h.Get(key); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// rateLimitTransport waits for the rate limiter before each round trip
+type rateLimitTransport struct {
+	limiter *RateLimiter
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.Wait(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if t.limiter.cfg.Adaptive {
+		t.limiter.limiter(req.URL.Host).observe(resp, time.Now())
+	}
+
+	resp.Body = &releaseOnCloseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseOnCloseBody releases the concurrency slot when the body is closed or fully read
+type releaseOnCloseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnCloseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.release()
+	}
+
+	return n, err
+}
+
+func (b *releaseOnCloseBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
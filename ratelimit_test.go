@@ -0,0 +1,149 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func TestRateLimiterRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetRateLimiter(NewRateLimiter(&RateLimiterConfig{
+		RequestsPerSecond: 20,
+		Burst:             1,
+	}))
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := f.Clone().Get("/").Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	elapsed := time.Since(start)
+	testify.Assert(t, elapsed >= 180*time.Millisecond, "Expected requests to be rate limited")
+}
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	var inflight, max int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetRateLimiter(NewRateLimiter(&RateLimiterConfig{
+		MaxConcurrency: 2,
+		PerHost:        true,
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.Clone().Get("/").Execute(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	testify.Equal(t, int32(2), atomic.LoadInt32(&max))
+}
+
+func TestRateLimiterContextCancel(t *testing.T) {
+	rl := NewRateLimiter(&RateLimiterConfig{RequestsPerSecond: 1, Burst: 1})
+
+	release, err := rl.Wait(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = rl.Wait(ctx, "example.com")
+	testify.Assert(t, err == context.DeadlineExceeded, "Expected context deadline exceeded")
+}
+
+func TestRateLimiterAdaptive(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1")
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetRateLimiter(NewRateLimiter(&RateLimiterConfig{Adaptive: true}))
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := f.Clone().Get("/").Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testify.Assert(t, time.Since(start) >= 900*time.Millisecond, "Expected to wait until reset")
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Now()
+
+	h := http.Header{}
+	h.Set("X-RateLimit-Remaining", "10")
+	h.Set("X-RateLimit-Reset", "30")
+	remaining, reset, ok := parseRateLimitHeaders(h, now)
+	testify.Assert(t, ok)
+	testify.Equal(t, 10, remaining)
+	testify.Equal(t, 30*time.Second, reset)
+
+	h = http.Header{}
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Reset", "1893456000")
+	remaining, reset, ok = parseRateLimitHeaders(h, time.Unix(1893455940, 0))
+	testify.Assert(t, ok)
+	testify.Equal(t, 0, remaining)
+	testify.Equal(t, time.Minute, reset)
+
+	h = http.Header{}
+	h.Set("RateLimit", "limit=100, remaining=50, reset=20")
+	remaining, reset, ok = parseRateLimitHeaders(h, now)
+	testify.Assert(t, ok)
+	testify.Equal(t, 50, remaining)
+	testify.Equal(t, 20*time.Second, reset)
+
+	h = http.Header{}
+	h.Set("RateLimit", `"default";r=5;t=10`)
+	remaining, reset, ok = parseRateLimitHeaders(h, now)
+	testify.Assert(t, ok)
+	testify.Equal(t, 5, remaining)
+	testify.Equal(t, 10*time.Second, reset)
+
+	_, _, ok = parseRateLimitHeaders(http.Header{}, now)
+	testify.Assert(t, !ok)
+}
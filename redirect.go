@@ -0,0 +1,192 @@
+package fetch
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"github.com/go-zoox/headers"
+)
+
+// DefaultMaxRedirects is the default maximum number of redirects to follow
+var DefaultMaxRedirects = 10
+
+// RedirectPolicy controls how redirects are followed,
+//
+//	by default, at most 10 redirects are followed, and credentials and custom headers
+//	are stripped when the redirect crosses hosts or downgrades from https to http.
+type RedirectPolicy struct {
+	// MaxRedirects is the maximum number of redirects to follow, zero means DefaultMaxRedirects
+	MaxRedirects int
+	// Disable disables following redirects, the 3xx response is returned,
+	//	use Response.Location() to get the redirect target
+	Disable bool
+
+	// OnRedirect is called before following each redirect, after the headers are stripped,
+	//	returning an error stops the redirect, http.ErrUseLastResponse returns the 3xx response
+	OnRedirect func(req *http.Request, via []*http.Request) error `json:"-"`
+
+	// ForwardAuthorization forwards the Authorization header cross origin
+	ForwardAuthorization bool
+	// ForwardCookie forwards the Cookie header set by SetCookie cross origin,
+	//	cookies in the cookie jar are always scoped by their domain
+	ForwardCookie bool
+	// ForwardHeaders forwards the custom headers set by SetHeader or AddHeader cross origin
+	ForwardHeaders bool
+}
+
+// Redirect is a followed redirect of the request
+type Redirect struct {
+	// Status is the status code of the redirect response
+	Status int
+	// URL is the url of the redirected request
+	URL string
+	// Location is the url redirected to
+	Location string
+}
+
+// safeRedirectHeaders are forwarded even when the redirect crosses origin
+var safeRedirectHeaders = map[string]bool{
+	headers.Accept:         true,
+	headers.AcceptEncoding: true,
+	headers.AcceptLanguage: true,
+	headers.UserAgent:      true,
+	headers.ContentType:    true,
+	headers.CacheControl:   true,
+}
+
+// SetRedirectPolicy sets the redirect policy
+func (f *Fetch) SetRedirectPolicy(policy *RedirectPolicy) *Fetch {
+	f.config.RedirectPolicy = policy
+	return f
+}
+
+// SetMaxRedirects sets the maximum number of redirects to follow
+func (f *Fetch) SetMaxRedirects(max int) *Fetch {
+	policy := f.redirectPolicy()
+	policy.MaxRedirects = max
+	f.config.RedirectPolicy = policy
+	return f
+}
+
+// DisableRedirect disables following redirects, the 3xx response is returned
+func (f *Fetch) DisableRedirect() *Fetch {
+	policy := f.redirectPolicy()
+	policy.Disable = true
+	f.config.RedirectPolicy = policy
+	return f
+}
+
+// redirectPolicy returns a copy of current policy, the policy may be shared by clones
+func (f *Fetch) redirectPolicy() *RedirectPolicy {
+	if f.config.RedirectPolicy == nil {
+		return &RedirectPolicy{}
+	}
+
+	policy := *f.config.RedirectPolicy
+	return &policy
+}
+
+// checkRedirect returns the http.Client CheckRedirect of the policy,
+//
+//	initial is the headers of the initial request, the followed redirects are appended to redirects.
+func (p *RedirectPolicy) checkRedirect(config *Config, initial http.Header, redirects *[]*Redirect) func(req *http.Request, via []*http.Request) error {
+	if p == nil {
+		p = &RedirectPolicy{}
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if p.Disable {
+			return http.ErrUseLastResponse
+		}
+
+		max := p.MaxRedirects
+		if max == 0 {
+			max = DefaultMaxRedirects
+		}
+
+		if len(via) > max {
+			return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, max)
+		}
+
+		redirect := &Redirect{
+			URL:      via[len(via)-1].URL.String(),
+			Location: req.URL.String(),
+		}
+		if req.Response != nil {
+			redirect.Status = req.Response.StatusCode
+		}
+
+		if isCrossOriginRedirect(via[0], req) {
+			p.stripHeaders(config, initial, req)
+		}
+
+		if p.OnRedirect != nil {
+			if err := p.OnRedirect(req, via); err != nil {
+				return err
+			}
+		}
+
+		*redirects = append(*redirects, redirect)
+		return nil
+	}
+}
+
+// stripHeaders strips the credentials and custom headers by the policy,
+//
+//	http.Client strips Authorization and Cookie itself on cross domain,
+//	so they are restored from the initial request if they should be forwarded.
+func (p *RedirectPolicy) stripHeaders(config *Config, initial http.Header, req *http.Request) {
+	if p.ForwardAuthorization {
+		if v := initial.Get(headers.Authorization); v != "" {
+			req.Header.Set(headers.Authorization, v)
+		}
+	} else {
+		req.Header.Del(headers.Authorization)
+	}
+
+	if p.ForwardCookie {
+		if v := initial.Get(headers.Cookie); v != "" {
+			req.Header.Set(headers.Cookie, v)
+		}
+	} else {
+		req.Header.Del(headers.Cookie)
+	}
+
+	if !p.ForwardHeaders {
+		for k := range config.Headers {
+			stripCustomHeader(req, k)
+		}
+		for k := range config.HeaderValues {
+			stripCustomHeader(req, k)
+		}
+	}
+}
+
+// stripCustomHeader strips the custom header unless it is safe to forward
+func stripCustomHeader(req *http.Request, key string) {
+	key = http.CanonicalHeaderKey(key)
+	if safeRedirectHeaders[key] || key == headers.Authorization || key == headers.Cookie {
+		return
+	}
+
+	req.Header.Del(key)
+}
+
+// isCrossOriginRedirect reports whether the redirect crosses hosts or downgrades from https
+func isCrossOriginRedirect(initial, req *http.Request) bool {
+	if !strings.EqualFold(initial.URL.Host, req.URL.Host) {
+		return true
+	}
+
+	return initial.URL.Scheme == "https" && req.URL.Scheme != "https"
+}
+
+// initialRequest returns the first request of the redirect chain
+func initialRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+
+	return req
+}
@@ -0,0 +1,175 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-zoox/testify"
+)
+
+func newEchoHeadersServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join([]string{
+			r.Header.Get("Authorization"),
+			r.Header.Get("Cookie"),
+			r.Header.Get("X-Api-Key"),
+			r.Header.Get("Accept"),
+		}, "|")))
+	}))
+}
+
+func TestRedirectSameOrigin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusMovedPermanently)
+		default:
+			w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get("X-Api-Key")))
+		}
+	}))
+	defer server.Close()
+
+	response, err := Create(server.URL).
+		SetBearToken("token").
+		SetHeader("X-Api-Key", "key").
+		Get("/a").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "Bearer token|key", response.String())
+	testify.Equal(t, 2, len(response.Redirects))
+	testify.Equal(t, http.StatusFound, response.Redirects[0].Status)
+	testify.Equal(t, server.URL+"/a", response.Redirects[0].URL)
+	testify.Equal(t, server.URL+"/b", response.Redirects[0].Location)
+	testify.Equal(t, http.StatusMovedPermanently, response.Redirects[1].Status)
+	testify.Equal(t, server.URL+"/c", response.Redirects[1].Location)
+}
+
+func TestRedirectCrossOrigin(t *testing.T) {
+	target := newEchoHeadersServer()
+	defer target.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).
+		SetBearToken("token").
+		SetCookie("sid", "1").
+		SetHeader("X-Api-Key", "key").
+		SetAccept("text/plain")
+
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "|||text/plain", response.String())
+
+	response, err = f.Clone().SetRedirectPolicy(&RedirectPolicy{
+		ForwardAuthorization: true,
+		ForwardCookie:        true,
+		ForwardHeaders:       true,
+	}).Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "Bearer token|sid=1|key|text/plain", response.String())
+}
+
+func TestRedirectCrossOriginHeaderValues(t *testing.T) {
+	target := newEchoHeadersServer()
+	defer target.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).
+		AddHeader("X-Api-Key", "key").
+		AddHeader("Accept", "text/plain")
+
+	response, err := f.Clone().Get("/", &Config{
+		HeaderValues: http.Header{"x-api-key": {"other"}},
+	}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "|||text/plain", response.String())
+
+	response, err = f.Clone().SetRedirectPolicy(&RedirectPolicy{ForwardHeaders: true}).Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "||key|text/plain", response.String())
+}
+
+func TestRedirectDisableAndMax(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	response, err := Create(server.URL).DisableRedirect().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusFound, response.Status)
+	testify.Equal(t, "/x", response.Location())
+	testify.Equal(t, 0, len(response.Redirects))
+
+	_, err = Create(server.URL).SetMaxRedirects(3).Get("/").Execute()
+	testify.Assert(t, err != nil && strings.Contains(err.Error(), "stopped after 3 redirects"))
+}
+
+func TestRedirectCallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/next", http.StatusFound)
+			return
+		}
+
+		w.Write([]byte(r.Header.Get("X-Redirected")))
+	}))
+	defer server.Close()
+
+	var locations []string
+	response, err := Create(server.URL).SetRedirectPolicy(&RedirectPolicy{
+		OnRedirect: func(req *http.Request, via []*http.Request) error {
+			locations = append(locations, req.URL.Path)
+			req.Header.Set("X-Redirected", "yes")
+			return nil
+		},
+	}).Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "yes", response.String())
+	testify.Equal(t, 1, len(locations))
+	testify.Equal(t, "/next", locations[0])
+
+	// stop with the last response
+	response, err = Create(server.URL).SetRedirectPolicy(&RedirectPolicy{
+		OnRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}).Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusFound, response.Status)
+
+	_, err = Create(server.URL).SetRedirectPolicy(&RedirectPolicy{
+		OnRedirect: func(req *http.Request, via []*http.Request) error {
+			return errors.New("redirect rejected")
+		},
+	}).Get("/").Execute()
+	testify.Assert(t, err != nil && strings.Contains(err.Error(), "redirect rejected"))
+}
@@ -3,7 +3,6 @@ package fetch
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -15,13 +14,25 @@ import (
 
 // Response is the fetch response
 type Response struct {
-	Status      int
+	Status int
+	// Proto is the negotiated protocol, like HTTP/1.1, HTTP/2.0
+	Proto       string
 	Headers     http.Header
 	Body        []byte
 	resultCache gjson.Result
 	parsed      bool
 	//
 	Request *Config
+	// Attempts is the number of attempts made by the retry policy
+	Attempts int
+	// CacheStatus is the status of http cache, like HIT, MISS, empty if cache is disabled
+	CacheStatus string
+	// Redirects is the redirect chain followed before the response
+	Redirects []*Redirect
+	// Timing is the timing report of the request, only if Config.Trace is enabled
+	Timing *Timing
+	// SessionError is the error of saving the session after the response, which does not fail the response
+	SessionError error
 	//
 	Stream io.ReadCloser
 }
@@ -79,9 +90,9 @@ func (r *Response) Ok() bool {
 	return r.Status >= 200 && r.Status < 300
 }
 
-// Error returns error with status and response string.
+// Error returns *HTTPError with status, headers and response body.
 func (r *Response) Error() error {
-	return fmt.Errorf("[%d] %s", r.Status, r.String())
+	return NewHTTPError(r)
 }
 
 // StatusCode returns status code of the response
@@ -0,0 +1,365 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-zoox/headers"
+)
+
+// RetryPolicy is the declarative retry policy of the request
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one,
+	//	less than 2 means no retry
+	MaxAttempts int
+	// InitialInterval is the backoff interval before the first retry, zero means 100ms
+	InitialInterval time.Duration
+	// MaxInterval is the maximum backoff interval, zero means 10s
+	MaxInterval time.Duration
+	// Multiplier is the exponential backoff multiplier, zero means 2
+	Multiplier float64
+	// Jitter randomizes the backoff interval by the given factor (0 ~ 1),
+	//	for example, 0.2 means the interval is between 80% and 120%
+	Jitter float64
+
+	// RetryOnStatus reports whether the response status should be retried,
+	//	default retries 408, 429, 500, 502, 503, 504
+	RetryOnStatus func(status int) bool `json:"-"`
+	// RetryOnError reports whether the transport error should be retried,
+	//	default retries all errors except the request context is done
+	RetryOnError func(err error) bool `json:"-"`
+
+	// RetryNonIdempotent allows retrying non-idempotent methods, like POST and PATCH,
+	//	by default they are only retried with an Idempotency-Key header
+	RetryNonIdempotent bool
+
+	// IgnoreRetryAfter ignores the Retry-After header of 429 and 503 responses
+	IgnoreRetryAfter bool
+	// MaxRetryAfter is the maximum Retry-After to wait, zero means 1 minute,
+	//	if the server asks to wait longer, the response is returned without retry
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy returns the default retry policy
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:     3,
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// DefaultRetryOnStatus is the default retryable status predicate
+func DefaultRetryOnStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// DefaultRetryOnError is the default retryable error predicate
+func DefaultRetryOnError(err error) bool {
+	return err != nil
+}
+
+// SetRetryPolicy sets the retry policy
+func (f *Fetch) SetRetryPolicy(policy *RetryPolicy) *Fetch {
+	f.config.RetryPolicy = policy
+	return f
+}
+
+// Backoff returns the backoff interval before the given retry (starts from 1)
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	initial := p.InitialInterval
+	if initial == 0 {
+		initial = 100 * time.Millisecond
+	}
+
+	max := p.MaxInterval
+	if max == 0 {
+		max = 10 * time.Second
+	}
+
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	interval := float64(initial) * math.Pow(multiplier, float64(retry-1))
+	if interval > float64(max) {
+		interval = float64(max)
+	}
+
+	if p.Jitter > 0 {
+		interval += interval * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(interval)
+}
+
+func (p *RetryPolicy) isRetryableMethod(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return p.RetryNonIdempotent || req.Header.Get("Idempotency-Key") != ""
+}
+
+func (p *RetryPolicy) isRetryableStatus(status int) bool {
+	if p.RetryOnStatus != nil {
+		return p.RetryOnStatus(status)
+	}
+
+	return DefaultRetryOnStatus(status)
+}
+
+func (p *RetryPolicy) isRetryableError(err error) bool {
+	if p.RetryOnError != nil {
+		return p.RetryOnError(err)
+	}
+
+	return DefaultRetryOnError(err)
+}
+
+// retryAfter returns the wait duration of Retry-After header on 429 and 503,
+//
+//	supports both delay seconds and http date.
+func (p *RetryPolicy) retryAfter(resp *http.Response) (time.Duration, bool) {
+	if p.IgnoreRetryAfter {
+		return 0, false
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	return parseRetryAfter(resp.Header.Get(headers.RetryAfter))
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// retrier retries the round trip by the retry policy
+type retrier struct {
+	policy *RetryPolicy
+	next   http.RoundTripper
+}
+
+func newRetrier(policy *RetryPolicy, next http.RoundTripper) *retrier {
+	return &retrier{
+		policy: policy,
+		next:   next,
+	}
+}
+
+// attemptsKey is the context key of the attempts counter of an execution
+type attemptsKey struct{}
+
+// withAttempts returns the context which records the attempts of the last round trip
+func withAttempts(ctx context.Context, attempts *int) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, attempts)
+}
+
+func recordAttempts(req *http.Request, attempts int) {
+	if counter, ok := req.Context().Value(attemptsKey{}).(*int); ok {
+		*counter = attempts
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *retrier) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	recordAttempts(req, attempts)
+	if r.policy == nil || r.policy.MaxAttempts < 2 || !r.policy.isRetryableMethod(req) {
+		return r.next.RoundTrip(req)
+	}
+
+	maxRetryAfter := r.policy.MaxRetryAfter
+	if maxRetryAfter == 0 {
+		maxRetryAfter = time.Minute
+	}
+
+	// every attempt sends its own request, the request of the caller is not mutated
+	attempt := req
+	for {
+		resp, err := r.next.RoundTrip(attempt)
+		if attempts >= r.policy.MaxAttempts || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := r.policy.Backoff(attempts)
+		if err != nil {
+			if !r.policy.isRetryableError(err) {
+				return resp, err
+			}
+		} else {
+			if !r.policy.isRetryableStatus(resp.StatusCode) {
+				return resp, err
+			}
+
+			if retryAfter, ok := r.policy.retryAfter(resp); ok {
+				if retryAfter > maxRetryAfter {
+					return resp, err
+				}
+
+				wait = retryAfter
+			}
+		}
+
+		// the body cannot be replayed
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		attempt = req.Clone(req.Context())
+		if req.GetBody != nil {
+			if attempt.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		attempts++
+		recordAttempts(req, attempts)
+	}
+}
+
+// DefaultMaxReplayBodySize is the maximum size of the request body buffered in memory for replay,
+//
+//	like retries and authentication challenges, the larger body is sent without replay.
+//	The seekable body is rewound instead, so it is not limited.
+var DefaultMaxReplayBodySize int64 = 4 << 20
+
+// makeBodyReplayable makes the request body replayable across attempts,
+//
+//	seekable bodies are rewound, others are buffered in memory.
+//	The seekable body is not closed by the transport, the caller closes it after all attempts.
+func makeBodyReplayable(req *http.Request) error {
+	return makeBodyReplayableUpTo(req, 0)
+}
+
+// makeBodyReplayableUpTo is makeBodyReplayable which buffers at most limit bytes, zero means no limit,
+//
+//	the larger body is sent as it is, so GetBody is nil and it is not replayed.
+func makeBodyReplayableUpTo(req *http.Request, limit int64) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+
+	if seeker, ok := req.Body.(io.ReadSeeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		req.Body = &seekableBody{seeker: seeker, offset: offset}
+		req.GetBody = func() (io.ReadCloser, error) {
+			return &seekableBody{seeker: seeker, offset: offset}, nil
+		}
+		return nil
+	}
+
+	var reader io.Reader = req.Body
+	if limit > 0 {
+		reader = io.LimitReader(req.Body, limit+1)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	if limit > 0 && int64(len(body)) > limit {
+		req.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+		return nil
+	}
+	req.Body.Close()
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return nil
+}
+
+// prefixedBody is the body read partially, the read bytes are read again before the rest
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// seekableBody reads the shared seeker from the offset,
+//
+//	it is rewound at the first read, so the readers (like signing and sending) are sequential,
+//	and closing it does not close the seeker.
+type seekableBody struct {
+	seeker  io.ReadSeeker
+	offset  int64
+	started bool
+}
+
+func (b *seekableBody) Read(p []byte) (int, error) {
+	if !b.started {
+		if _, err := b.seeker.Seek(b.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		b.started = true
+	}
+
+	return b.seeker.Read(p)
+}
+
+func (b *seekableBody) Close() error {
+	return nil
+}
@@ -0,0 +1,283 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func newFlakyServer(failures int32, status int) (*httptest.Server, *int32) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&count, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Write(body)
+	}))
+
+	return server, &count
+}
+
+func TestRetryPolicy(t *testing.T) {
+	server, count := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	response, err := New().
+		SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}).
+		Put(server.URL, &Config{Body: map[string]string{"hello": "world"}}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, http.StatusOK, response.Status)
+	testify.Equal(t, 3, response.Attempts)
+	testify.Equal(t, int32(3), atomic.LoadInt32(count))
+	testify.Equal(t, `{"hello":"world"}`, response.String())
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	server, count := newFlakyServer(5, http.StatusBadGateway)
+	defer server.Close()
+
+	response, err := Get(server.URL, &Config{
+		RetryPolicy: &RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, http.StatusBadGateway, response.Status)
+	testify.Equal(t, 2, response.Attempts)
+	testify.Equal(t, int32(2), atomic.LoadInt32(count))
+}
+
+func TestRetryPolicyNonIdempotent(t *testing.T) {
+	server, count := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}
+
+	response, err := Post(server.URL, &Config{Body: "hello", RetryPolicy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusServiceUnavailable, response.Status)
+	testify.Equal(t, 1, response.Attempts)
+	testify.Equal(t, int32(1), atomic.LoadInt32(count))
+
+	response, err = Post(server.URL, &Config{
+		Body:        "hello",
+		Headers:     Headers{"Idempotency-Key": "key"},
+		RetryPolicy: policy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusOK, response.Status)
+	testify.Equal(t, "hello", response.String())
+}
+
+func TestRetryPolicyFileBody(t *testing.T) {
+	server, count := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "body.txt")
+	if err := os.WriteFile(path, []byte("file body"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := New().
+		SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}).
+		Put(server.URL, &Config{
+			Headers: Headers{"Content-Type": "application/octet-stream"},
+			Body:    file,
+		}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "file body", response.String())
+	testify.Equal(t, int32(3), atomic.LoadInt32(count))
+	testify.Equal(t, 3, response.Attempts)
+
+	// the file is closed after all the attempts
+	_, err = file.Read(make([]byte, 1))
+	testify.Assert(t, errors.Is(err, os.ErrClosed), "expected the file is closed")
+}
+
+// streamingBody is the non-seekable body, which ends only after the server receives the request,
+//
+//	so it fails if the body is buffered before the request is sent.
+type streamingBody struct {
+	data     string
+	received chan struct{}
+}
+
+func (b *streamingBody) Read(p []byte) (int, error) {
+	if b.data != "" {
+		n := copy(p, b.data)
+		b.data = b.data[n:]
+		return n, nil
+	}
+
+	select {
+	case <-b.received:
+		return 0, io.EOF
+	case <-time.After(time.Second):
+		return 0, errors.New("the body is buffered before the request is sent")
+	}
+}
+
+func TestRetryPolicyStreamingBody(t *testing.T) {
+	var count int32
+	var received chan struct{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		close(received)
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}
+	for _, c := range []struct {
+		method string
+		policy *RetryPolicy
+	}{
+		// the method is not retried
+		{method: http.MethodPost, policy: policy},
+		// no retry
+		{method: http.MethodPut, policy: &RetryPolicy{MaxAttempts: 1}},
+		// the body is larger than DefaultMaxReplayBodySize
+		{method: http.MethodPut, policy: policy},
+	} {
+		atomic.StoreInt32(&count, 0)
+		received = make(chan struct{})
+
+		data := "hello"
+		if c.method == http.MethodPut && c.policy == policy {
+			data = strings.Repeat("hello", int(DefaultMaxReplayBodySize)/5+1)
+		}
+
+		response, err := New().SetRetryPolicy(c.policy).SetConfig(&Config{
+			URL:     server.URL,
+			Method:  c.method,
+			Headers: Headers{"Content-Type": "application/octet-stream"},
+			Body:    &streamingBody{data: data, received: received},
+		}).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, http.StatusServiceUnavailable, response.Status)
+		testify.Equal(t, data, response.String())
+		testify.Equal(t, 1, response.Attempts)
+		testify.Equal(t, int32(1), atomic.LoadInt32(&count))
+	}
+}
+
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	var last time.Time
+	var wait time.Duration
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			last = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		wait = time.Since(last)
+	}))
+	defer server.Close()
+
+	response, err := Get(server.URL, &Config{
+		RetryPolicy: &RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, http.StatusOK, response.Status)
+	testify.Assert(t, wait >= time.Second, "Expected Retry-After to be honored")
+}
+
+func TestRetryPolicyContextCancel(t *testing.T) {
+	server, _ := newFlakyServer(5, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := New().
+		SetContext(ctx).
+		SetRetryPolicy(&RetryPolicy{MaxAttempts: 5, InitialInterval: time.Second}).
+		Get(server.URL).
+		Execute()
+	testify.Assert(t, err != nil, "Expected error, got nil")
+}
+
+func TestRetryPolicyError(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		// the connection is closed without response
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer server.Close()
+
+	_, err := New().
+		SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}).
+		Get(server.URL).
+		Execute()
+	testify.Assert(t, errors.Is(err, ErrSendingRequest), "Expected ErrSendingRequest")
+	testify.Equal(t, int32(3), atomic.LoadInt32(&count))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	wait, ok := parseRetryAfter("120")
+	testify.Assert(t, ok)
+	testify.Equal(t, 120*time.Second, wait)
+
+	wait, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	testify.Assert(t, ok)
+	testify.Assert(t, wait > 59*time.Minute && wait <= time.Hour)
+
+	_, ok = parseRetryAfter("invalid")
+	testify.Assert(t, !ok)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second}
+	testify.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	testify.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	testify.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	testify.Equal(t, time.Second, policy.Backoff(10))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		backoff := policy.Backoff(1)
+		testify.Assert(t, backoff >= 50*time.Millisecond && backoff <= 150*time.Millisecond)
+	}
+}
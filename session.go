@@ -1,10 +1,17 @@
 package fetch
 
-// Session is remembered between requests
-func Session() *Fetch {
+// Session is remembered between requests,
+//
+//	if the store is given, the session is restored from it, and saved after each response.
+func Session(store ...SessionStore) *Fetch {
 	f := New()
 
 	f.config.IsSession = true
+	f.config.CookieJar = NewCookieJar()
+
+	if len(store) > 0 && store[0] != nil {
+		f.SetSessionStore(store[0])
+	}
 
 	return f
 }
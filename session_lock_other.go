@@ -0,0 +1,24 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+
+package fetch
+
+import (
+	"os"
+	"sync"
+)
+
+// sessionFileLocks are the locks of the files, the platforms without advisory lock only lock in the process
+var sessionFileLocks sync.Map
+
+func tryLockFile(file *os.File) (bool, error) {
+	mu, _ := sessionFileLocks.LoadOrStore(file.Name(), &sync.Mutex{})
+	return mu.(*sync.Mutex).TryLock(), nil
+}
+
+func unlockFile(file *os.File) error {
+	if mu, ok := sessionFileLocks.Load(file.Name()); ok {
+		mu.(*sync.Mutex).Unlock()
+	}
+
+	return nil
+}
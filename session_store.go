@@ -0,0 +1,399 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-zoox/core-utils/fmt"
+)
+
+// SessionState is the persisted state of a session
+type SessionState struct {
+	Cookies []*CookieEntry    `json:"cookies"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// SessionStore saves and restores the session state across process restarts,
+//
+//	Save replaces the stored state with the state of the session, the stored state is not merged,
+//	so if the processes share the store, the last saved one wins,
+//	and the cookies saved by the others since the last LoadSession are lost.
+type SessionStore interface {
+	Load() (*SessionState, error)
+	Save(state *SessionState) error
+}
+
+// DefaultSessionLockTimeout is the maximum time to wait for the session file lock
+var DefaultSessionLockTimeout = 10 * time.Second
+
+// JSONSessionStore stores the session as json file,
+//
+//	the listed headers, like Authorization, are stored with the cookies.
+type JSONSessionStore struct {
+	Path    string
+	Headers []string
+}
+
+// NewJSONSessionStore creates a json session store,
+//
+//	headers are the names of the request headers to persist, like Authorization.
+func NewJSONSessionStore(path string, headers ...string) *JSONSessionStore {
+	return &JSONSessionStore{
+		Path:    path,
+		Headers: headers,
+	}
+}
+
+// Load loads the session state, empty if the file does not exist
+func (s *JSONSessionStore) Load() (*SessionState, error) {
+	state := &SessionState{}
+
+	data, err := readSessionFile(s.Path)
+	if err != nil || len(data) == 0 {
+		return state, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse session file(%s): %w", s.Path, err)
+	}
+
+	return state, nil
+}
+
+// Save saves the session state, only the listed headers are saved
+func (s *JSONSessionStore) Save(state *SessionState) error {
+	saved := &SessionState{
+		Cookies: state.Cookies,
+		Headers: pickHeaders(state.Headers, s.Headers),
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeSessionFile(s.Path, data)
+}
+
+// NetscapeSessionStore stores the cookies in Netscape cookies.txt format,
+//
+//	which is compatible with curl and wget, headers are not stored.
+type NetscapeSessionStore struct {
+	Path string
+}
+
+// NewNetscapeSessionStore creates a Netscape cookies.txt session store
+func NewNetscapeSessionStore(path string) *NetscapeSessionStore {
+	return &NetscapeSessionStore{
+		Path: path,
+	}
+}
+
+// Load loads the cookies, empty if the file does not exist
+func (s *NetscapeSessionStore) Load() (*SessionState, error) {
+	state := &SessionState{}
+
+	data, err := readSessionFile(s.Path)
+	if err != nil || len(data) == 0 {
+		return state, err
+	}
+
+	state.Cookies, err = parseNetscapeCookies(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cookies file(%s): %w", s.Path, err)
+	}
+
+	return state, nil
+}
+
+// Save saves the cookies
+func (s *NetscapeSessionStore) Save(state *SessionState) error {
+	return writeSessionFile(s.Path, formatNetscapeCookies(state.Cookies))
+}
+
+// SetSessionStore sets the session store, and restores the session from it
+func (f *Fetch) SetSessionStore(store SessionStore) *Fetch {
+	f.config.IsSession = true
+	f.config.SessionStore = store
+	if f.config.CookieJar == nil {
+		f.config.CookieJar = NewCookieJar()
+	}
+
+	if err := f.LoadSession(); err != nil {
+		f.Errors = append(f.Errors, err)
+	}
+
+	return f
+}
+
+// LoadSession restores the cookies and headers from the session store
+func (f *Fetch) LoadSession() error {
+	if f.config.SessionStore == nil {
+		return nil
+	}
+
+	state, err := f.config.SessionStore.Load()
+	if err != nil {
+		return err
+	}
+
+	if f.config.CookieJar == nil {
+		f.config.CookieJar = NewCookieJar()
+	}
+	f.config.CookieJar.AddEntries(state.Cookies...)
+	// the restored cookies are not changes to save
+	f.config.CookieJar.markSaved(f.config.CookieJar.currentVersion())
+
+	for k, v := range state.Headers {
+		f.SetHeader(k, v)
+	}
+
+	return nil
+}
+
+// SaveSession saves the cookies and headers to the session store
+func (f *Fetch) SaveSession() error {
+	return saveSession(f.config)
+}
+
+func saveSession(config *Config) error {
+	if config.SessionStore == nil || config.CookieJar == nil {
+		return nil
+	}
+
+	version := config.CookieJar.currentVersion()
+	if err := config.SessionStore.Save(&SessionState{
+		Cookies: config.CookieJar.Entries(),
+		Headers: config.Headers,
+	}); err != nil {
+		return err
+	}
+
+	config.CookieJar.markSaved(version)
+	return nil
+}
+
+func pickHeaders(all map[string]string, names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+
+	picked := map[string]string{}
+	for _, name := range names {
+		for k, v := range all {
+			if strings.EqualFold(k, name) && v != "" {
+				picked[k] = v
+			}
+		}
+	}
+
+	return picked
+}
+
+// parseNetscapeCookies parses the cookies.txt,
+//
+//	each line is: domain, include subdomains, path, secure, expires, name, value, separated by tab.
+func parseNetscapeCookies(data []byte) ([]*CookieEntry, error) {
+	var entries []*CookieEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := false
+		if strings.HasPrefix(text, "#HttpOnly_") {
+			httpOnly = true
+			text = strings.TrimPrefix(text, "#HttpOnly_")
+		}
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("invalid cookie at line %d", line)
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie expires at line %d: %w", line, err)
+		}
+
+		entry := &CookieEntry{
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+
+		// zero expires means session cookie
+		if expires > 0 {
+			entry.Persistent = true
+			entry.Expires = time.Unix(expires, 0)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+func formatNetscapeCookies(entries []*CookieEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Netscape HTTP Cookie File\n")
+	buf.WriteString("# This file is generated by go-zoox/fetch, edit at your own risk.\n\n")
+
+	for _, entry := range entries {
+		domain := entry.Domain
+		includeSubdomains := "FALSE"
+		if !entry.HostOnly {
+			domain = "." + domain
+			includeSubdomains = "TRUE"
+		}
+
+		if entry.HttpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+
+		secure := "FALSE"
+		if entry.Secure {
+			secure = "TRUE"
+		}
+
+		var expires int64
+		if entry.Persistent {
+			expires = entry.Expires.Unix()
+		}
+
+		buf.WriteString(strings.Join([]string{
+			domain,
+			includeSubdomains,
+			entry.Path,
+			secure,
+			strconv.FormatInt(expires, 10),
+			entry.Name,
+			entry.Value,
+		}, "\t"))
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes()
+}
+
+func readSessionFile(path string) ([]byte, error) {
+	unlock, err := lockSessionFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// writeSessionFile writes the session file atomically, under the file lock
+func writeSessionFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	unlock, err := lockSessionFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// lockSessionFile acquires the lock of the session file across processes,
+//
+//	the lock is the advisory lock of the sibling .lock file, like flock,
+//	which is released by the OS if the process crashes, so the lock is never taken over.
+func lockSessionFile(path string) (unlock func(), err error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(DefaultSessionLockTimeout)
+
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// the directory does not exist, nothing to lock
+				return func() {}, nil
+			}
+
+			return nil, err
+		}
+
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		// the lock file may be removed by the last holder before it is locked, then the new one is locked
+		if locked && isSameFile(file, lockPath) {
+			return func() {
+				os.Remove(lockPath)
+				unlockFile(file)
+				file.Close()
+			}, nil
+		}
+
+		if locked {
+			unlockFile(file)
+		}
+		file.Close()
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrSessionLocked, path)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// isSameFile reports whether the opened file is still the file of the path
+func isSameFile(file *os.File, path string) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(info, current)
+}
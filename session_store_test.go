@@ -0,0 +1,196 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func newLoginServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc==", Path: "/", MaxAge: 3600, HttpOnly: true})
+			http.SetCookie(w, &http.Cookie{Name: "tmp", Value: "1", Path: "/"})
+		}
+
+		w.Write([]byte(r.Header.Get("Cookie") + "|" + r.Header.Get("Authorization")))
+	}))
+}
+
+func TestSessionStoreJSON(t *testing.T) {
+	server := newLoginServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	s := Session(NewJSONSessionStore(path, "Authorization"))
+	s.SetBaseURL(server.URL).SetBearToken("token")
+	if _, err := s.Clone().Get("/login").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restored by a new process
+	s = Session(NewJSONSessionStore(path, "Authorization"))
+	s.SetBaseURL(server.URL)
+	response, err := s.Clone().Get("/me").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "sid=abc==; tmp=1|Bearer token", response.String())
+}
+
+func TestSessionStoreNetscape(t *testing.T) {
+	server := newLoginServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+
+	s := Session(NewNetscapeSessionStore(path))
+	s.SetBaseURL(server.URL)
+	if _, err := s.Clone().Get("/login").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Assert(t, strings.HasPrefix(string(data), "# Netscape HTTP Cookie File"))
+	testify.Assert(t, strings.Contains(string(data), "#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t"))
+	testify.Assert(t, strings.Contains(string(data), "127.0.0.1\tFALSE\t/\tFALSE\t0\ttmp\t1\n"))
+
+	s = Session(NewNetscapeSessionStore(path))
+	s.SetBaseURL(server.URL)
+	response, err := s.Clone().Get("/me").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "sid=abc==; tmp=1|", response.String())
+}
+
+func TestParseNetscapeCookies(t *testing.T) {
+	_, err := parseNetscapeCookies([]byte(".example.com\tTRUE\t/\tTRUE\n"))
+	testify.Assert(t, err != nil, "Expected invalid line error")
+
+	data := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tTRUE\t0\ta\t1\n" +
+		"#HttpOnly_www.example.com\tFALSE\t/api\tFALSE\t0\tb\tx=y\n"
+	entries, err := parseNetscapeCookies([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, 2, len(entries))
+	testify.Equal(t, "example.com", entries[0].Domain)
+	testify.Assert(t, !entries[0].HostOnly && entries[0].Secure)
+	testify.Assert(t, entries[1].HostOnly && entries[1].HttpOnly)
+	testify.Equal(t, "x=y", entries[1].Value)
+
+	testify.Equal(t, data[len("# Netscape HTTP Cookie File\n"):], strings.SplitN(string(formatNetscapeCookies(entries)), "\n\n", 2)[1])
+}
+
+func TestSessionStoreLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	store := NewJSONSessionStore(path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := store.Save(&SessionState{Cookies: []*CookieEntry{{Name: "n", Value: strings.Repeat("v", i*100), Domain: "example.com", Path: "/"}}})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, 1, len(state.Cookies))
+
+	_, err = os.Stat(path + ".lock")
+	testify.Assert(t, os.IsNotExist(err), "Expected lock file removed")
+}
+
+func TestSessionStoreLockHeld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	store := NewJSONSessionStore(path)
+
+	timeout := DefaultSessionLockTimeout
+	DefaultSessionLockTimeout = 50 * time.Millisecond
+	defer func() { DefaultSessionLockTimeout = timeout }()
+
+	unlock, err := lockSessionFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lock held for long is not taken over
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+	err = store.Save(&SessionState{})
+	testify.Assert(t, errors.Is(err, ErrSessionLocked), "Expected session locked")
+
+	unlock()
+	if err := store.Save(&SessionState{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type countingSessionStore struct {
+	saves int32
+	err   error
+}
+
+func (s *countingSessionStore) Load() (*SessionState, error) {
+	return &SessionState{}, nil
+}
+
+func (s *countingSessionStore) Save(state *SessionState) error {
+	atomic.AddInt32(&s.saves, 1)
+	return s.err
+}
+
+func TestSessionStoreSaveOnChange(t *testing.T) {
+	server := newLoginServer()
+	defer server.Close()
+
+	store := &countingSessionStore{}
+	s := Session(store)
+	s.SetBaseURL(server.URL)
+
+	if _, err := s.Clone().Get("/login").Execute(); err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, int32(1), atomic.LoadInt32(&store.saves))
+
+	// the cookies are not changed
+	if _, err := s.Clone().Get("/me").Execute(); err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, int32(1), atomic.LoadInt32(&store.saves))
+
+	// the failure of saving does not fail the response
+	store.err = errors.New("disk full")
+	response, err := s.Clone().Get("/login").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, int32(2), atomic.LoadInt32(&store.saves))
+	testify.Equal(t, http.StatusOK, response.Status)
+	testify.Assert(t, errors.Is(response.SessionError, store.err), "expected the session error")
+}
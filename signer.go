@@ -0,0 +1,309 @@
+package fetch
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"github.com/go-zoox/headers"
+)
+
+// Signer signs the fully built request, after params, query and body are applied,
+//
+//	it can add headers or query params to the request.
+//	the request is signed on each attempt, so that the signing time is fresh on retry.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc is the function adapter of Signer
+type SignerFunc func(req *http.Request) error
+
+// Sign implements Signer
+func (fn SignerFunc) Sign(req *http.Request) error {
+	return fn(req)
+}
+
+// DefaultClockSkewTolerance is the tolerated clock difference from the server,
+//
+//	if the server Date differs more, the signing time is corrected by the difference.
+var DefaultClockSkewTolerance = 30 * time.Second
+
+// SetSigner sets the request signer
+func (f *Fetch) SetSigner(signer Signer) *Fetch {
+	if signer != nil && clockSkewsOf(signer) == nil {
+		signer = &skewSigner{Signer: signer}
+	}
+
+	f.config.Signer = signer
+	return f
+}
+
+// SigningTime returns the time to sign the request with,
+//
+//	which is corrected by the clock skew learned by the signer from the server Date header.
+func SigningTime(req *http.Request) time.Time {
+	skews, _ := req.Context().Value(clockSkewsKey{}).(*clockSkews)
+	return skews.now(req.URL.Host)
+}
+
+// clockSkews is the clock difference of the servers by host, kept by the signer instance
+type clockSkews struct {
+	hosts sync.Map
+}
+
+func (s *clockSkews) skews() *clockSkews {
+	return s
+}
+
+// clockSkewsOf returns the clock skews of the signer, nil if it has none, like SignerFunc of Config
+func clockSkewsOf(signer Signer) *clockSkews {
+	if s, ok := signer.(interface{ skews() *clockSkews }); ok {
+		return s.skews()
+	}
+
+	return nil
+}
+
+// skewSigner keeps the clock skews for the signer which has none, like SignerFunc
+type skewSigner struct {
+	Signer
+	clockSkews
+}
+
+type clockSkewsKey struct{}
+
+// now returns the current time corrected by the clock skew of the host
+func (s *clockSkews) now(host string) time.Time {
+	now := time.Now()
+	if s == nil {
+		return now.UTC()
+	}
+
+	if skew, ok := s.hosts.Load(host); ok {
+		now = now.Add(skew.(time.Duration))
+	}
+
+	return now.UTC()
+}
+
+// learn records the clock difference from the server Date header,
+//
+//	returns true if the difference is beyond the tolerance and changed.
+func (s *clockSkews) learn(req *http.Request, resp *http.Response) bool {
+	if s == nil {
+		return false
+	}
+
+	date, err := http.ParseTime(resp.Header.Get(headers.Date))
+	if err != nil {
+		return false
+	}
+
+	skew := time.Until(date)
+	if skew > -DefaultClockSkewTolerance && skew < DefaultClockSkewTolerance {
+		s.hosts.Delete(req.URL.Host)
+		return false
+	}
+
+	previous, _ := s.hosts.Load(req.URL.Host)
+	s.hosts.Store(req.URL.Host, skew)
+	if previous == nil {
+		return true
+	}
+
+	diff := skew - previous.(time.Duration)
+	return diff <= -DefaultClockSkewTolerance || diff >= DefaultClockSkewTolerance
+}
+
+// signerTransport signs each attempt,
+//
+//	and re-signs and retries once if the request is rejected for the clock skew.
+type signerTransport struct {
+	signer Signer
+	next   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *signerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTrip(req)
+	if err != nil || !clockSkewsOf(t.signer).learn(req, resp) {
+		return resp, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return resp, nil
+	}
+
+	// the body cannot be replayed
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.roundTrip(retry)
+}
+
+func (t *signerTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	// the clock skews of the signer are used by SigningTime
+	signed := req.Clone(context.WithValue(req.Context(), clockSkewsKey{}, clockSkewsOf(t.signer)))
+	if err := t.signer.Sign(signed); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return t.next.RoundTrip(signed)
+}
+
+// readSigningBody returns the request body to sign, the body is kept replayable
+func readSigningBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if err := makeBodyReplayable(req); err != nil {
+		return nil, err
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// HMACSignerConfig is the config of HMAC-SHA256 header signer
+type HMACSignerConfig struct {
+	KeyID  string
+	Secret string
+
+	// KeyIDHeader is the header of key id, default X-Key-Id
+	KeyIDHeader string
+	// TimestampHeader is the header of unix timestamp, default X-Timestamp
+	TimestampHeader string
+	// SignatureHeader is the header of signature, default X-Signature
+	SignatureHeader string
+	// Base64 encodes the signature as base64, default hex
+	Base64 bool
+
+	// StringToSign returns the string to sign, default:
+	//	METHOD \n PATH \n SORTED QUERY \n TIMESTAMP \n HEX(SHA256(BODY))
+	StringToSign func(req *http.Request, timestamp string, bodyHash string) string `json:"-"`
+	// Now returns the signing time, default SigningTime
+	Now func() time.Time `json:"-"`
+}
+
+// HMACSigner signs the request with HMAC-SHA256 over method, path, sorted query, timestamp and body hash
+type HMACSigner struct {
+	clockSkews
+	config *HMACSignerConfig
+}
+
+// NewHMACSigner creates an HMAC-SHA256 header signer
+func NewHMACSigner(cfg *HMACSignerConfig) *HMACSigner {
+	return &HMACSigner{
+		config: cfg,
+	}
+}
+
+// Sign implements Signer
+func (s *HMACSigner) Sign(req *http.Request) error {
+	body, err := readSigningBody(req)
+	if err != nil {
+		return err
+	}
+
+	now := s.clockSkews.now(req.URL.Host)
+	if s.config.Now != nil {
+		now = s.config.Now()
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	bodyHash := sha256.Sum256(body)
+
+	stringToSign := s.config.StringToSign
+	if stringToSign == nil {
+		stringToSign = DefaultHMACStringToSign
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.config.Secret))
+	mac.Write([]byte(stringToSign(req, timestamp, hex.EncodeToString(bodyHash[:]))))
+
+	signature := hex.EncodeToString(mac.Sum(nil))
+	if s.config.Base64 {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	if s.config.KeyID != "" {
+		req.Header.Set(orDefault(s.config.KeyIDHeader, "X-Key-Id"), s.config.KeyID)
+	}
+	req.Header.Set(orDefault(s.config.TimestampHeader, "X-Timestamp"), timestamp)
+	req.Header.Set(orDefault(s.config.SignatureHeader, "X-Signature"), signature)
+
+	return nil
+}
+
+// DefaultHMACStringToSign is the default string to sign of HMACSigner
+func DefaultHMACStringToSign(req *http.Request, timestamp string, bodyHash string) string {
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return strings.Join([]string{
+		req.Method,
+		path,
+		sortedQuery(req.URL.Query()),
+		timestamp,
+		bodyHash,
+	}, "\n")
+}
+
+// sortedQuery encodes the query sorted by key and value
+func sortedQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func orDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
@@ -0,0 +1,196 @@
+package fetch
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+// the request of RFC 9421 appendix B.2
+func newRFC9421Request() *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	return req
+}
+
+func TestHTTPSignatureHMAC(t *testing.T) {
+	key, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+
+	req := newRFC9421Request()
+	err := NewHTTPSignatureSigner(&HTTPSignatureConfig{
+		KeyID:      "test-shared-secret",
+		Algorithm:  HTTPSignatureHMACSHA256,
+		Key:        key,
+		Components: []string{"date", "@authority", "content-type"},
+		Label:      "sig-b25",
+		Now:        func() time.Time { return time.Unix(1618884473, 0) },
+	}).Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`, req.Header.Get("Signature-Input"))
+	testify.Equal(t, "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:", req.Header.Get("Signature"))
+}
+
+func TestHTTPSignatureEd25519(t *testing.T) {
+	der, _ := base64.StdEncoding.DecodeString("MC4CAQAwBQYDK2VwBCIEIJ+DYvh6SEqVTm50DFtMDoQikTmiCqirVv9mWG9qfSnF")
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := newRFC9421Request()
+	req.ContentLength = 18
+	err = NewHTTPSignatureSigner(&HTTPSignatureConfig{
+		KeyID:      "test-key-ed25519",
+		Algorithm:  HTTPSignatureEd25519,
+		Key:        key.(ed25519.PrivateKey),
+		Components: []string{"date", "@method", "@path", "@authority", "content-type", "content-length"},
+		Label:      "sig-b26",
+		Now:        func() time.Time { return time.Unix(1618884473, 0) },
+	}).Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testify.Equal(t, "sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:", req.Header.Get("Signature"))
+}
+
+func TestHTTPSignatureContentDigest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		if r.Header.Get("Content-Digest") != "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(r.Header.Get("Signature-Input")))
+	}))
+	defer server.Close()
+
+	response, err := Create(server.URL).SetSigner(NewHTTPSignatureSigner(&HTTPSignatureConfig{
+		KeyID:         "key",
+		Algorithm:     HTTPSignatureHMACSHA256,
+		Key:           []byte("secret"),
+		ContentDigest: true,
+		Tag:           "app",
+	})).Post("/items", &Config{Body: map[string]string{"a": "b"}}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusOK, response.Status)
+	testify.Assert(t, strings.HasPrefix(response.String(), `sig1=("@method" "@authority" "@path" "@query" "content-digest");created=`), response.String())
+	testify.Assert(t, strings.HasSuffix(response.String(), `;keyid="key";tag="app"`), response.String())
+}
+
+func TestHMACSigner(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodyHash := sha256.Sum256(body)
+		stringToSign := strings.Join([]string{r.Method, r.URL.EscapedPath(), "a=1&b=3", r.Header.Get("X-Timestamp"), hex.EncodeToString(bodyHash[:])}, "\n")
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(stringToSign))
+		if r.Header.Get("X-Key-Id") != "partner" || r.Header.Get("X-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	response, err := Create(server.URL).
+		SetSigner(NewHMACSigner(&HMACSignerConfig{KeyID: "partner", Secret: "secret"})).
+		SetQuery("b", "3").
+		Post("/orders/:id", &Config{
+			Params: map[string]string{"id": "42"},
+			Query:  map[string]string{"a": "1"},
+			Body:   map[string]string{"item": "book"},
+		}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "ok", response.String())
+}
+
+func TestSignerClockSkew(t *testing.T) {
+	// the server clock is one hour ahead
+	serverNow := func() time.Time { return time.Now().Add(time.Hour) }
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Date", serverNow().UTC().Format(http.TimeFormat))
+
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Timestamp"), 10, 64)
+		if d := serverNow().Sub(time.Unix(timestamp, 0)); d > time.Minute || d < -time.Minute {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetSigner(NewHMACSigner(&HMACSignerConfig{Secret: "secret"}))
+
+	// rejected, then re-signed with the server time
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "ok", response.String())
+	testify.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// the clock skew is remembered
+	response, err = f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "ok", response.String())
+	testify.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// the clock skew is kept by the signer instance, the signer func of SetSigner too
+	signer := SignerFunc(func(req *http.Request) error {
+		req.Header.Set("X-Timestamp", strconv.FormatInt(SigningTime(req).Unix(), 10))
+		return nil
+	})
+	for _, f := range []*Fetch{
+		Create(server.URL).SetSigner(NewHMACSigner(&HMACSignerConfig{Secret: "secret"})),
+		Create(server.URL).SetSigner(signer),
+	} {
+		atomic.StoreInt32(&requests, 0)
+		response, err = f.Clone().Get("/").Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, "ok", response.String())
+		testify.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+		response, err = f.Clone().Get("/").Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, "ok", response.String())
+		testify.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	}
+}
@@ -0,0 +1,78 @@
+package fetch
+
+// StatusRange is the inclusive range of status codes, like {400, 499}
+type StatusRange struct {
+	From int
+	To   int
+}
+
+// Contains reports whether the status is in the range
+func (r StatusRange) Contains(status int) bool {
+	return status >= r.From && status <= r.To
+}
+
+// StatusClientError is the range of 4xx statuses
+var StatusClientError = StatusRange{From: 400, To: 499}
+
+// StatusServerError is the range of 5xx statuses
+var StatusServerError = StatusRange{From: 500, To: 599}
+
+// SetFailOnStatus makes Execute return *HTTPError together with the response for the failure statuses,
+//
+//	the failure statuses are the given ranges, default all non-2xx statuses.
+func (f *Fetch) SetFailOnStatus(ranges ...StatusRange) *Fetch {
+	f.config.FailOnStatus = true
+	f.config.FailStatusRanges = ranges
+	return f
+}
+
+// SetExpectedStatus sets the expected statuses which are never failures, like 404
+func (f *Fetch) SetExpectedStatus(statuses ...int) *Fetch {
+	f.config.ExpectedStatuses = statuses
+	return f
+}
+
+// isFailureStatus reports whether the status is a failure of the config
+func isFailureStatus(config *Config, status int) bool {
+	if !config.FailOnStatus {
+		return false
+	}
+
+	return isFailureStatusOf(config, status)
+}
+
+// isFailureStatusOf reports whether the status is a failure of the ranges and expected statuses of the config,
+//
+//	whether FailOnStatus is set or not.
+func isFailureStatusOf(config *Config, status int) bool {
+	if config == nil {
+		return status < 200 || status >= 300
+	}
+
+	for _, expected := range config.ExpectedStatuses {
+		if status == expected {
+			return false
+		}
+	}
+
+	if len(config.FailStatusRanges) == 0 {
+		return status < 200 || status >= 300
+	}
+
+	for _, r := range config.FailStatusRanges {
+		if r.Contains(status) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkStatus returns *HTTPError with the response if the status is a failure
+func checkStatus(response *Response, err error) (*Response, error) {
+	if err != nil || response == nil || !isFailureStatus(response.Request, response.Status) {
+		return response, err
+	}
+
+	return response, NewHTTPError(response)
+}
@@ -0,0 +1,99 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func newStatusServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(status)
+		w.Write([]byte("status " + strconv.Itoa(status)))
+	}))
+}
+
+func TestFailOnStatusDisabled(t *testing.T) {
+	server := newStatusServer()
+	defer server.Close()
+
+	response, err := Get(server.URL + "?status=500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusInternalServerError, response.Status)
+}
+
+func TestFailOnStatus(t *testing.T) {
+	server := newStatusServer()
+	defer server.Close()
+
+	f := Create(server.URL).SetFailOnStatus()
+
+	response, err := f.Clone().SetQuery("status", "500").Get("/").Execute()
+	testify.Assert(t, errors.Is(err, ErrUnexpectedStatus), "expected ErrUnexpectedStatus")
+	testify.Assert(t, response != nil, "expected the response with error")
+	testify.Equal(t, http.StatusInternalServerError, response.Status)
+
+	httpErr, ok := AsHTTPError(err)
+	testify.Assert(t, ok, "expected *HTTPError")
+	testify.Equal(t, "status 500", string(httpErr.Body))
+
+	_, err = f.Clone().SetQuery("status", "204").Get("/").Execute()
+	testify.Assert(t, err == nil, "2xx should not fail")
+
+	// per request override
+	response, err = f.Clone().SetQuery("status", "404").Get("/", &Config{ExpectedStatuses: []int{404}}).Execute()
+	testify.Assert(t, err == nil, "404 is expected")
+	testify.Equal(t, http.StatusNotFound, response.Status)
+
+	_, err = f.Clone().SetExpectedStatus(http.StatusConflict).SetQuery("status", "404").Get("/").Execute()
+	testify.Assert(t, errors.Is(err, ErrUnexpectedStatus), "404 is not expected")
+}
+
+func TestFailOnStatusRanges(t *testing.T) {
+	server := newStatusServer()
+	defer server.Close()
+
+	f := Create(server.URL).SetFailOnStatus(StatusServerError)
+
+	_, err := f.Clone().SetQuery("status", "404").Get("/").Execute()
+	testify.Assert(t, err == nil, "4xx is not in the ranges")
+
+	_, err = f.Clone().SetQuery("status", "503").Get("/").Execute()
+	testify.Assert(t, errors.Is(err, ErrUnexpectedStatus), "5xx is in the ranges")
+
+	_, err = Get(server.URL+"?status=418", &Config{
+		FailOnStatus:     true,
+		FailStatusRanges: []StatusRange{{From: 418, To: 418}},
+	})
+	testify.Assert(t, errors.Is(err, ErrUnexpectedStatus), "418 is in the ranges")
+}
+
+func TestFailOnStatusWithRetry(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("attempt " + strconv.Itoa(int(attempt))))
+	}))
+	defer server.Close()
+
+	response, err := Create(server.URL).
+		SetFailOnStatus().
+		SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond, IgnoreRetryAfter: true}).
+		Get("/").
+		Execute()
+
+	httpErr, ok := AsHTTPError(err)
+	testify.Assert(t, ok, "expected *HTTPError")
+	testify.Equal(t, "attempt 3", string(httpErr.Body))
+	testify.Equal(t, 3, response.Attempts)
+}
@@ -9,5 +9,5 @@ func Stream(url string, config ...interface{}) (*Response, error) {
 		return nil, ErrTooManyArguments
 	}
 
-	return New().Stream(url, c).Execute()
+	return shared().Stream(url, c).Execute()
 }
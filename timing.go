@@ -0,0 +1,233 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Timing is the timing report of the request, collected by net/http/httptrace,
+//
+//	with retries, it is the timing of the last attempt.
+type Timing struct {
+	// DNSLookup is the duration of resolving the host, zero if the connection is reused or the host is an IP
+	DNSLookup time.Duration
+	// TCPConnect is the duration of establishing the TCP connection
+	TCPConnect time.Duration
+	// TLSHandshake is the duration of the TLS handshake
+	TLSHandshake time.Duration
+	// ServerProcessing is the duration from the request written to the first response byte
+	ServerProcessing time.Duration
+	// TimeToFirstByte is the duration from the request start to the first response byte
+	TimeToFirstByte time.Duration
+	// ContentTransfer is the duration of reading the response body, zero for stream
+	ContentTransfer time.Duration
+	// Total is the duration from the request start to the response body read,
+	//	for stream, it is the same as TimeToFirstByte
+	Total time.Duration
+
+	// ConnectionReused reports whether the connection is reused from the idle pool
+	ConnectionReused bool
+	// RemoteAddr is the address of the server, or the proxy
+	RemoteAddr string
+}
+
+// SetTrace collects the timing of the request into Response.Timing
+func (f *Fetch) SetTrace(enable bool) *Fetch {
+	f.config.Trace = enable
+	return f
+}
+
+// SetDialTimeout sets the timeout of establishing the TCP connection
+func (f *Fetch) SetDialTimeout(timeout time.Duration) *Fetch {
+	f.config.DialTimeout = timeout
+	return f
+}
+
+// SetTLSHandshakeTimeout sets the timeout of the TLS handshake
+func (f *Fetch) SetTLSHandshakeTimeout(timeout time.Duration) *Fetch {
+	f.config.TLSHandshakeTimeout = timeout
+	return f
+}
+
+// SetResponseHeaderTimeout sets the timeout of waiting for the response headers
+func (f *Fetch) SetResponseHeaderTimeout(timeout time.Duration) *Fetch {
+	f.config.ResponseHeaderTimeout = timeout
+	return f
+}
+
+// SetIdleReadTimeout sets the maximum idle time between reads of the response body
+func (f *Fetch) SetIdleReadTimeout(timeout time.Duration) *Fetch {
+	f.config.IdleReadTimeout = timeout
+	return f
+}
+
+// timingTracer records the httptrace events,
+//
+//	the events may come from the dialing goroutines, so they are guarded by the mutex.
+type timingTracer struct {
+	sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+
+	reused     bool
+	remoteAddr string
+}
+
+func (t *timingTracer) record(at *time.Time) {
+	t.Lock()
+	*at = time.Now()
+	t.Unlock()
+}
+
+// trace returns the client trace, each attempt starts over from GetConn
+func (t *timingTracer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			t.Lock()
+			defer t.Unlock()
+
+			t.start = time.Now()
+			t.dnsStart, t.dnsDone = time.Time{}, time.Time{}
+			t.connectStart, t.connectDone = time.Time{}, time.Time{}
+			t.tlsStart, t.tlsDone = time.Time{}, time.Time{}
+			t.wroteRequest, t.firstByte = time.Time{}, time.Time{}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(&t.dnsDone)
+		},
+		ConnectStart: func(network, addr string) {
+			t.Lock()
+			defer t.Unlock()
+
+			// keep the first one of the parallel dials (happy eyeballs)
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.record(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.record(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(&t.tlsDone)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.Lock()
+			defer t.Unlock()
+
+			t.reused = info.Reused
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.record(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.record(&t.firstByte)
+		},
+	}
+}
+
+// timing returns the timing report, end is the time the response body is read,
+//
+//	zero end means the body is not read, like stream.
+func (t *timingTracer) timing(end time.Time) *Timing {
+	if t == nil {
+		return nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if end.IsZero() {
+		end = t.firstByte
+	}
+
+	return &Timing{
+		DNSLookup:        between(t.dnsStart, t.dnsDone),
+		TCPConnect:       between(t.connectStart, t.connectDone),
+		TLSHandshake:     between(t.tlsStart, t.tlsDone),
+		ServerProcessing: between(t.wroteRequest, t.firstByte),
+		TimeToFirstByte:  between(t.start, t.firstByte),
+		ContentTransfer:  between(t.firstByte, end),
+		Total:            between(t.start, end),
+		//
+		ConnectionReused: t.reused,
+		RemoteAddr:       t.remoteAddr,
+	}
+}
+
+// between returns the duration from start to end, zero if any is missing
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+
+	return end.Sub(start)
+}
+
+// idleTimeoutReader fails the read if no data arrives within the timeout,
+//
+//	the body is closed to unblock the pending read.
+type idleTimeoutReader struct {
+	body     io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut int32
+}
+
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration) *idleTimeoutReader {
+	r := &idleTimeoutReader{
+		body:    body,
+		timeout: timeout,
+	}
+
+	r.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&r.timedOut, 1)
+		r.body.Close()
+	})
+	r.timer.Stop()
+
+	return r
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&r.timedOut) == 1 {
+		return 0, ErrIdleReadTimeout
+	}
+
+	r.timer.Reset(r.timeout)
+	n, err := r.body.Read(p)
+	r.timer.Stop()
+
+	if err != nil && atomic.LoadInt32(&r.timedOut) == 1 {
+		return n, ErrIdleReadTimeout
+	}
+
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
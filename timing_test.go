@@ -0,0 +1,87 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func TestTiming(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetConfig(&Config{TLSInsecureSkipVerify: true}).SetTrace(true)
+
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timing := response.Timing
+	testify.Assert(t, timing != nil, "expected timing")
+	testify.Assert(t, !timing.ConnectionReused, "expected a new connection")
+	testify.Assert(t, timing.TCPConnect > 0, "expected tcp connect")
+	testify.Assert(t, timing.TLSHandshake > 0, "expected tls handshake")
+	testify.Assert(t, timing.ServerProcessing >= 50*time.Millisecond, "expected server processing")
+	testify.Assert(t, timing.TimeToFirstByte >= timing.ServerProcessing, "expected time to first byte")
+	testify.Assert(t, timing.Total >= timing.TimeToFirstByte, "expected total")
+	testify.Equal(t, server.Listener.Addr().String(), timing.RemoteAddr)
+
+	response, err = f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Assert(t, response.Timing.ConnectionReused, "expected the reused connection")
+	testify.Equal(t, time.Duration(0), response.Timing.TCPConnect)
+	testify.Equal(t, time.Duration(0), response.Timing.TLSHandshake)
+
+	response, err = Get(server.URL, &Config{TLSInsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Assert(t, response.Timing == nil, "trace is disabled")
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	_, err := Create(server.URL).SetResponseHeaderTimeout(20 * time.Millisecond).Get("/").Execute()
+	testify.Assert(t, errors.Is(err, ErrSendingRequest), "expected ErrSendingRequest")
+	testify.Assert(t, IsTimeout(err), "expected timeout")
+}
+
+func TestIdleReadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Write([]byte(" body"))
+	}))
+	defer server.Close()
+
+	f := Create(server.URL).SetIdleReadTimeout(50 * time.Millisecond)
+
+	response, err := f.Clone().Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "partial body", response.String())
+
+	_, err = f.Clone().Get("/slow").Execute()
+	testify.Assert(t, errors.Is(err, ErrReadingResponse), "expected ErrReadingResponse")
+	testify.Assert(t, errors.Is(err, ErrIdleReadTimeout), "expected ErrIdleReadTimeout")
+	testify.Assert(t, IsTimeout(err), "expected timeout")
+}
@@ -0,0 +1,369 @@
+package fetch
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/core-utils/fmt"
+)
+
+// DefaultMaxIdleConns is the default maximum number of idle connections across all hosts
+var DefaultMaxIdleConns = 100
+
+// DefaultIdleConnTimeout is the default idle connection timeout
+var DefaultIdleConnTimeout = 90 * time.Second
+
+// DefaultKeepAlive is the default keep-alive period for active connections
+var DefaultKeepAlive = 30 * time.Second
+
+// DefaultDialTimeout is the default timeout of establishing the TCP connection
+var DefaultDialTimeout = 30 * time.Second
+
+// DefaultTLSHandshakeTimeout is the default timeout of the TLS handshake
+var DefaultTLSHandshakeTimeout = 10 * time.Second
+
+// transportKey identifies a transport by the settings which affect how connections are made,
+//
+//	requests with the same key can safely share connections.
+type transportKey struct {
+	UnixDomainSocket string
+	HTTP2            bool
+	H2C              string
+	//
+	TLSCaCert             string
+	TLSCert               string
+	TLSKey                string
+	TLSInsecureSkipVerify bool
+	//
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	DisableKeepAlives   bool
+	//
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	//
+	HostOverrides string
+	Resolver      Resolver
+	LocalAddr     string
+	Interface     string
+}
+
+func newTransportKey(config *Config) transportKey {
+	return transportKey{
+		UnixDomainSocket: strings.TrimPrefix(config.UnixDomainSocket, "unix://"),
+		HTTP2:            config.HTTP2,
+		H2C:              config.H2C,
+		//
+		TLSCaCert:             string(config.TLSCaCert),
+		TLSCert:               string(config.TLSCert),
+		TLSKey:                string(config.TLSKey),
+		TLSInsecureSkipVerify: config.TLSInsecureSkipVerify,
+		//
+		MaxIdleConns:        config.MaxIdleConns,
+		MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     config.MaxConnsPerHost,
+		IdleConnTimeout:     config.IdleConnTimeout,
+		KeepAlive:           config.KeepAlive,
+		DisableKeepAlives:   config.DisableKeepAlives,
+		//
+		DialTimeout:           config.DialTimeout,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		//
+		HostOverrides: hostOverridesKey(config.HostOverrides),
+		Resolver:      config.Resolver,
+		LocalAddr:     config.LocalAddr,
+		Interface:     config.Interface,
+	}
+}
+
+// DefaultMaxTransports is the maximum number of cached transports of a fetch (and the package level methods),
+//
+//	the least recently used one is evicted and its idle connections are closed,
+//	like the transports of the resolvers created for every request.
+var DefaultMaxTransports = 64
+
+// transportCache caches transports by their effective settings,
+//
+//	so that connections are reused between requests instead of dialing every time.
+type transportCache struct {
+	sync.Mutex
+	transports map[transportKey]*list.Element
+	// lru is the list of *cachedTransport, the front is the most recently used
+	lru *list.List
+}
+
+type cachedTransport struct {
+	key       transportKey
+	transport http.RoundTripper
+}
+
+func newTransportCache() *transportCache {
+	return &transportCache{
+		transports: make(map[transportKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// defaultTransports is shared by the package level methods, like fetch.Get
+var defaultTransports = newTransportCache()
+
+// Get returns the cached transport for the config, builds one if not exists
+func (tc *transportCache) Get(config *Config) (http.RoundTripper, error) {
+	key := newTransportKey(config)
+
+	// the key cannot be hashed with the resolver like ResolverFunc of Config,
+	//	the transport is not cached, so the connections are not kept alive to be leaked
+	if !isComparableResolver(key.Resolver) {
+		key.DisableKeepAlives = true
+		return newTransport(key)
+	}
+
+	tc.Lock()
+	defer tc.Unlock()
+
+	if element, ok := tc.transports[key]; ok {
+		tc.lru.MoveToFront(element)
+		return element.Value.(*cachedTransport).transport, nil
+	}
+
+	tr, err := newTransport(key)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.transports[key] = tc.lru.PushFront(&cachedTransport{key: key, transport: tr})
+	for tc.lru.Len() > DefaultMaxTransports {
+		oldest := tc.lru.Remove(tc.lru.Back()).(*cachedTransport)
+		delete(tc.transports, oldest.key)
+		closeIdleConnections(oldest.transport)
+	}
+
+	return tr, nil
+}
+
+// len returns the number of cached transports
+func (tc *transportCache) len() int {
+	tc.Lock()
+	defer tc.Unlock()
+
+	return tc.lru.Len()
+}
+
+// resolverRef is the comparable reference of the resolver like ResolverFunc,
+//
+//	the transports are cached by the identity of the reference.
+type resolverRef struct {
+	Resolver
+}
+
+// comparableResolver returns the resolver which can be the key of the transport cache
+func comparableResolver(resolver Resolver) Resolver {
+	if isComparableResolver(resolver) {
+		return resolver
+	}
+
+	return &resolverRef{Resolver: resolver}
+}
+
+func isComparableResolver(resolver Resolver) bool {
+	return resolver == nil || reflect.TypeOf(resolver).Comparable()
+}
+
+// parentTransport is the connection settings of the parent request,
+//
+//	which are inherited by the internal requests, like the OAuth2 token and DoH requests.
+type parentTransport struct {
+	config     *Config
+	transports *transportCache
+}
+
+type parentTransportKey struct{}
+
+// withParentTransport returns the context which carries the connection settings of the config
+func withParentTransport(ctx context.Context, config *Config, transports *transportCache) context.Context {
+	return context.WithValue(ctx, parentTransportKey{}, &parentTransport{
+		config:     config,
+		transports: transports,
+	})
+}
+
+// inheritTransport applies the connection settings of the parent request in the context,
+//
+//	like the proxy, tls, timeouts and the connection pool, while the unix domain socket is not inherited.
+func (f *Fetch) inheritTransport(ctx context.Context) *Fetch {
+	parent, ok := ctx.Value(parentTransportKey{}).(*parentTransport)
+	if !ok {
+		return f
+	}
+
+	config := parent.config
+	f.config.Timeout = config.Timeout
+	f.config.DialTimeout = config.DialTimeout
+	f.config.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+	f.config.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	//
+	f.config.Proxy = config.Proxy
+	f.config.NoProxy = config.NoProxy
+	f.config.ProxyRules = config.ProxyRules
+	f.config.ProxyFunc = config.ProxyFunc
+	f.config.ProxyAuth = config.ProxyAuth
+	f.config.ProxyHeaders = config.ProxyHeaders
+	//
+	f.config.HTTP2 = config.HTTP2
+	f.config.TLSCaCert = config.TLSCaCert
+	f.config.TLSCert = config.TLSCert
+	f.config.TLSKey = config.TLSKey
+	f.config.TLSInsecureSkipVerify = config.TLSInsecureSkipVerify
+	//
+	f.config.HostOverrides = config.HostOverrides
+	f.config.Resolver = config.Resolver
+	f.config.LocalAddr = config.LocalAddr
+	f.config.Interface = config.Interface
+	//
+	f.config.MaxIdleConns = config.MaxIdleConns
+	f.config.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	f.config.MaxConnsPerHost = config.MaxConnsPerHost
+	f.config.IdleConnTimeout = config.IdleConnTimeout
+	f.config.KeepAlive = config.KeepAlive
+	f.config.DisableKeepAlives = config.DisableKeepAlives
+
+	f.transports = parent.transports
+	return f
+}
+
+// CloseIdleConnections closes the idle connections of all cached transports
+func (tc *transportCache) CloseIdleConnections() {
+	tc.Lock()
+	defer tc.Unlock()
+
+	for element := tc.lru.Front(); element != nil; element = element.Next() {
+		closeIdleConnections(element.Value.(*cachedTransport).transport)
+	}
+}
+
+func closeIdleConnections(tr http.RoundTripper) {
+	if ci, ok := tr.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+func newTransport(key transportKey) (http.RoundTripper, error) {
+	keepAlive := key.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAlive
+	}
+
+	maxIdleConns := key.MaxIdleConns
+	if maxIdleConns == 0 {
+		maxIdleConns = DefaultMaxIdleConns
+	}
+
+	idleConnTimeout := key.IdleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = DefaultIdleConnTimeout
+	}
+
+	dialTimeout := key.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = DefaultDialTimeout
+	}
+
+	tlsHandshakeTimeout := key.TLSHandshakeTimeout
+	if tlsHandshakeTimeout == 0 {
+		tlsHandshakeTimeout = DefaultTLSHandshakeTimeout
+	}
+
+	dialer := &hostDialer{
+		dialer: &net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: keepAlive,
+		},
+		overrides: parseHostOverridesKey(key.HostOverrides),
+		resolver:  key.Resolver,
+		localAddr: key.LocalAddr,
+		iface:     key.Interface,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxyFromContext,
+		GetProxyConnectHeader: proxyConnectHeaderFromContext,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   key.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       key.MaxConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		DisableKeepAlives:     key.DisableKeepAlives,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ResponseHeaderTimeout: key.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	tlsConfig, err := newTLSConfig(key)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	// unix domain socket: https://gist.github.com/teknoraver/5ffacb8757330715bcbcc90e6d46ac74
+	if key.UnixDomainSocket != "" {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.dialer.DialContext(ctx, "unix", key.UnixDomainSocket)
+		}
+	}
+
+	if key.HTTP2 {
+		if err := configureHTTP2(transport); err != nil {
+			return nil, err
+		}
+	}
+
+	if key.H2C != "" {
+		return newH2CTransport(key.H2C, transport)
+	}
+
+	return transport, nil
+}
+
+func newTLSConfig(key transportKey) (*tls.Config, error) {
+	if key.TLSCaCert == "" && key.TLSCert == "" && key.TLSKey == "" && !key.TLSInsecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	// https://stackoverflow.com/questions/38822764/how-to-send-a-https-request-with-a-certificate-golang
+	if key.TLSCaCert != "" {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(key.TLSCaCert))
+		tlsConfig.RootCAs = pool
+	}
+
+	if key.TLSCert != "" && key.TLSKey != "" {
+		clientCrt, err := tls.X509KeyPair([]byte(key.TLSCert), []byte(key.TLSKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client cert and key: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{clientCrt}
+	}
+
+	if key.TLSInsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = key.TLSInsecureSkipVerify
+	}
+
+	return tlsConfig, nil
+}
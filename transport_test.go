@@ -0,0 +1,127 @@
+package fetch
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/testify"
+)
+
+func TestTransportReuseConnection(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	f := Create(server.URL)
+	for i := 0; i < 5; i++ {
+		response, err := f.Clone().Get("/").Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, "ok", response.String())
+	}
+
+	testify.Equal(t, int32(1), atomic.LoadInt32(&conns))
+	f.CloseIdleConnections()
+}
+
+func TestTransportCacheKey(t *testing.T) {
+	tc := newTransportCache()
+
+	tr1, err := tc.Get(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr2, err := tc.Get(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Assert(t, tr1 == tr2, "Expected same transport for same config")
+
+	tr3, err := tc.Get(&Config{TLSInsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Assert(t, tr1 != tr3, "Expected different transport for different tls config")
+	testify.Assert(t, tr1.(*http.Transport).TLSClientConfig == nil, "Expected tls config not leaked")
+	testify.Assert(t, tr3.(*http.Transport).TLSClientConfig.InsecureSkipVerify, "Expected insecure skip verify")
+
+	tr4, err := tc.Get(&Config{MaxIdleConnsPerHost: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, 10, tr4.(*http.Transport).MaxIdleConnsPerHost)
+
+	// the resolver func of SetResolver is cached by the reference
+	resolver := comparableResolver(ResolverFunc(func(ctx context.Context, host string) ([]string, error) {
+		return []string{"127.0.0.1"}, nil
+	}))
+
+	tr5, err := tc.Get(&Config{Resolver: resolver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr6, err := tc.Get(&Config{Resolver: resolver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Assert(t, tr5 == tr6, "Expected same transport for same resolver")
+
+	// the resolver func of Config is not cached, and the connections are not kept alive
+	tr7, err := tc.Get(&Config{Resolver: ResolverFunc(net.DefaultResolver.LookupHost)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Assert(t, tr7.(*http.Transport).DisableKeepAlives, "Expected keep alives disabled")
+}
+
+func TestTransportTLSIsolation(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	response, err := Get(server.URL, &Config{TLSInsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "ok", response.String())
+
+	if _, err := Get(server.URL); err == nil {
+		t.Fatal("Expected certificate error, got nil")
+	}
+}
+
+func TestTransportCacheBounded(t *testing.T) {
+	server, port := newHostServer()
+	defer server.Close()
+
+	// the resolver is created for every request
+	for i := 0; i < DefaultMaxTransports+10; i++ {
+		response, err := Get("http://cache.internal:"+port+"/", &Config{
+			Resolver: NewCachedResolver(ResolverFunc(func(ctx context.Context, host string) ([]string, error) {
+				return []string{"127.0.0.1"}, nil
+			}), time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		testify.Equal(t, "cache.internal:"+port+"|127.0.0.1", response.String())
+	}
+
+	testify.Equal(t, DefaultMaxTransports, defaultTransports.len())
+}
@@ -0,0 +1,113 @@
+package fetch
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"strings"
+
+	"github.com/go-zoox/core-utils/fmt"
+	"gopkg.in/yaml.v3"
+)
+
+// Do executes the fetch and decodes the response body into T,
+//
+//	returns *HTTPError with the response if the status is a failure,
+//	which is not 2xx by default, see SetFailOnStatus and SetExpectedStatus.
+//	the body is decoded by the Content-Type, see Response.Decode.
+func Do[T any](f *Fetch) (T, *Response, error) {
+	var value T
+
+	response, err := f.Execute()
+	if err != nil {
+		return value, response, err
+	}
+
+	if isFailureStatusOf(response.Request, response.Status) {
+		return value, response, NewHTTPError(response)
+	}
+
+	if err := response.Decode(&value); err != nil {
+		return value, response, err
+	}
+
+	return value, response, nil
+}
+
+// GetJSON sends a GET request and decodes the response body into T
+func GetJSON[T any](url string, config ...*Config) (T, *Response, error) {
+	return Do[T](shared().Get(url, config...))
+}
+
+// PostJSON sends a POST request and decodes the response body into T
+func PostJSON[T any](url string, config ...*Config) (T, *Response, error) {
+	return Do[T](shared().Post(url, config...))
+}
+
+// PutJSON sends a PUT request and decodes the response body into T
+func PutJSON[T any](url string, config ...*Config) (T, *Response, error) {
+	return Do[T](shared().Put(url, config...))
+}
+
+// PatchJSON sends a PATCH request and decodes the response body into T
+func PatchJSON[T any](url string, config ...*Config) (T, *Response, error) {
+	return Do[T](shared().Patch(url, config...))
+}
+
+// DeleteJSON sends a DELETE request and decodes the response body into T
+func DeleteJSON[T any](url string, config ...*Config) (T, *Response, error) {
+	return Do[T](shared().Delete(url, config...))
+}
+
+// Decode decodes the body into v by the Content-Type,
+//
+//	JSON (application/json, +json), YAML (application/yaml, +yaml) and XML (application/xml, text/xml, +xml),
+//	JSON is used if the Content-Type is missing.
+//	*string and *[]byte get the raw body, an empty body leaves v untouched.
+func (r *Response) Decode(v interface{}) error {
+	switch target := v.(type) {
+	case *string:
+		*target = r.String()
+		return nil
+	case *[]byte:
+		*target = r.Body
+		return nil
+	}
+
+	if len(r.Body) == 0 {
+		return nil
+	}
+
+	var err error
+	switch mediaType := r.mediaType(); {
+	case mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		err = json.Unmarshal(r.Body, v)
+	case mediaType == "application/yaml" || mediaType == "application/x-yaml" || mediaType == "text/yaml" || strings.HasSuffix(mediaType, "+yaml"):
+		err = yaml.Unmarshal(r.Body, v)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		err = xml.Unmarshal(r.Body, v)
+	default:
+		return fmt.Errorf("%w: cannot decode %s", ErrInvalidContentType, mediaType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to decode %s body: %w", r.mediaType(), err)
+	}
+
+	return nil
+}
+
+// mediaType returns the lowercase media type of Content-Type without params
+func (r *Response) mediaType() string {
+	contentType := r.ContentType()
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+
+	return mediaType
+}
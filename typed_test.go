@@ -0,0 +1,125 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-zoox/testify"
+)
+
+type typedUser struct {
+	ID   int    `json:"id" yaml:"id" xml:"id"`
+	Name string `json:"name" yaml:"name" xml:"name"`
+}
+
+func newTypedServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"id":1,"name":"zero"}`))
+		case "/yaml":
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write([]byte("id: 2\nname: one\n"))
+		case "/xml":
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte("<user><id>3</id><name>two</name></user>"))
+		case "/echo":
+			w.Header().Set("Content-Type", "application/vnd.api+json")
+			w.Write([]byte(`{"id":4,"name":"` + r.Method + `"}`))
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("hello"))
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+		}
+	}))
+}
+
+func TestDoDecodesByContentType(t *testing.T) {
+	server := newTypedServer()
+	defer server.Close()
+
+	user, response, err := GetJSON[typedUser](server.URL + "/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusOK, response.Status)
+	testify.Equal(t, typedUser{ID: 1, Name: "zero"}, user)
+
+	user, _, err = Do[typedUser](Create(server.URL).Get("/yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, typedUser{ID: 2, Name: "one"}, user)
+
+	user, _, err = Do[typedUser](Create(server.URL).Get("/xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, typedUser{ID: 3, Name: "two"}, user)
+
+	user, _, err = PostJSON[typedUser](server.URL+"/echo", &Config{Body: map[string]string{"a": "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, typedUser{ID: 4, Name: "POST"}, user)
+
+	text, _, err := Do[string](Create(server.URL).Get("/text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "hello", text)
+
+	pointer, response, err := Do[*typedUser](Create(server.URL).Delete("/empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusNoContent, response.Status)
+	testify.Assert(t, pointer == nil, "empty body should leave the zero value")
+}
+
+func TestDoHTTPError(t *testing.T) {
+	server := newTypedServer()
+	defer server.Close()
+
+	_, response, err := Do[typedUser](Create(server.URL).Get("/missing"))
+
+	var httpErr *HTTPError
+	testify.Assert(t, errors.As(err, &httpErr), "expected *HTTPError")
+	testify.Equal(t, http.StatusNotFound, httpErr.Status)
+	testify.Equal(t, "not found", string(httpErr.Body))
+	testify.Equal(t, "[404] not found", err.Error())
+	testify.Assert(t, httpErr.Response == response, "expected the response in error")
+}
+
+func TestDoExpectedStatus(t *testing.T) {
+	server := newTypedServer()
+	defer server.Close()
+
+	body, response, err := Do[string](Create(server.URL).SetExpectedStatus(http.StatusNotFound).Get("/missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, http.StatusNotFound, response.Status)
+	testify.Equal(t, "not found", body)
+
+	// only the 5xx statuses are failures
+	_, _, err = Do[string](Create(server.URL).SetFailOnStatus(StatusServerError).Get("/missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoUnsupportedContentType(t *testing.T) {
+	server := newTypedServer()
+	defer server.Close()
+
+	_, _, err := Do[typedUser](Create(server.URL).Get("/text"))
+	testify.Assert(t, errors.Is(err, ErrInvalidContentType), "expected ErrInvalidContentType")
+}
@@ -11,5 +11,5 @@ func Upload(url string, file io.Reader, config ...interface{}) (*Response, error
 		return nil, ErrTooManyArguments
 	}
 
-	return New().Upload(url, file, c).Execute()
+	return shared().Upload(url, file, c).Execute()
 }
@@ -0,0 +1,367 @@
+package fetch
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-zoox/core-utils/fmt"
+)
+
+// SetParamValue sets the param value of the URI template,
+//
+//	the value is string, []string (list) or map[string]string (associative array),
+//	like {/segments*} or {?filter*}, see ExpandURITemplate.
+func (f *Fetch) SetParamValue(key string, value interface{}) *Fetch {
+	if f.config.ParamValues == nil {
+		f.config.ParamValues = make(map[string]interface{})
+	}
+
+	f.config.ParamValues[key] = value
+	return f
+}
+
+// SetStrictParams sets the strict mode of params, the unresolved {name} and /:name are errors
+func (f *Fetch) SetStrictParams(strict bool) *Fetch {
+	f.config.StrictParams = strict
+	return f
+}
+
+// ExpandURITemplate expands the URI template (RFC 6570, level 4) with the values,
+//
+//	like {id}, {+path}, {#fragment}, {.ext}, {/segments*}, {;params}, {?q,page}, {&next}
+//	and the prefix {name:3}. The legacy :name is expanded as {name} if the value is defined.
+//	The value is string, []string, map[string]string, or the scalar (bool, number),
+//	the nil value is removed as undefined.
+//
+//	The expression without any known variable and the invalid expression are kept literally,
+//	like {"a":1} in the query, while the strict mode returns ErrUnresolvedParam
+//	for the unknown {name} and /:name.
+func ExpandURITemplate(template string, values map[string]interface{}, strict bool) (string, error) {
+	var b strings.Builder
+	// the port of host is not a param, like http://127.0.0.1:8080
+	pathStart := templatePathStart(template)
+
+	for i := 0; i < len(template); {
+		switch c := template[i]; {
+		case c == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end == -1 {
+				if strict {
+					return "", fmt.Errorf("invalid uri template, unclosed expression at %d: %s", i, template)
+				}
+
+				b.WriteString(template[i:])
+				return b.String(), nil
+			}
+
+			expression := template[i+1 : i+end]
+			if !strict && !isKnownExpression(expression, values) {
+				b.WriteString(template[i : i+end+1])
+			} else if err := expandExpression(&b, expression, values, strict); err != nil {
+				return "", err
+			}
+			i += end + 1
+		case c == ':' && i >= pathStart:
+			name := colonParamName(template[i+1:])
+			if _, ok := values[name]; name == "" || !ok {
+				// only the whole segment is a param in the strict mode, like /users/:id,
+				//	while /v1/projects:batchGet is literal
+				if strict && name != "" && i > 0 && template[i-1] == '/' {
+					return "", fmt.Errorf("%w: %s", ErrUnresolvedParam, name)
+				}
+
+				b.WriteByte(c)
+				i++
+				continue
+			}
+
+			if err := expandExpression(&b, name, values, strict); err != nil {
+				return "", err
+			}
+			i += len(name) + 1
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String(), nil
+}
+
+// isKnownExpression reports whether the expression is valid, and any of the variables is known
+func isKnownExpression(expression string, values map[string]interface{}) bool {
+	if expression != "" {
+		if _, ok := templateOperators[expression[0]]; ok {
+			expression = expression[1:]
+		}
+	}
+
+	known := false
+	for _, spec := range strings.Split(expression, ",") {
+		name, _, _, err := parseVarSpec(spec)
+		if err != nil {
+			return false
+		}
+
+		if _, ok := values[name]; ok {
+			known = true
+		}
+	}
+
+	return known
+}
+
+// templateOperator is the expression operator, see RFC 6570 Appendix A
+type templateOperator struct {
+	first    string
+	sep      string
+	named    bool
+	ifemp    string
+	reserved bool
+}
+
+var templateOperators = map[byte]templateOperator{
+	'+': {first: "", sep: ",", reserved: true},
+	'#': {first: "#", sep: ",", reserved: true},
+	'.': {first: ".", sep: "."},
+	'/': {first: "/", sep: "/"},
+	';': {first: ";", sep: ";", named: true},
+	'?': {first: "?", sep: "&", named: true, ifemp: "="},
+	'&': {first: "&", sep: "&", named: true, ifemp: "="},
+}
+
+func expandExpression(b *strings.Builder, expression string, values map[string]interface{}, strict bool) error {
+	op := templateOperator{sep: ","}
+	if expression != "" {
+		if o, ok := templateOperators[expression[0]]; ok {
+			op = o
+			expression = expression[1:]
+		} else if strings.ContainsRune("=,!@|", rune(expression[0])) {
+			return fmt.Errorf("invalid uri template, reserved operator: {%s}", expression)
+		}
+	}
+
+	first := true
+	for _, spec := range strings.Split(expression, ",") {
+		name, explode, prefix, err := parseVarSpec(spec)
+		if err != nil {
+			return err
+		}
+
+		value, ok := values[name]
+		if !ok {
+			if strict {
+				return fmt.Errorf("%w: %s", ErrUnresolvedParam, name)
+			}
+
+			continue
+		}
+
+		text, defined := expandValue(op, name, value, explode, prefix)
+		if !defined {
+			continue
+		}
+
+		if first {
+			b.WriteString(op.first)
+			first = false
+		} else {
+			b.WriteString(op.sep)
+		}
+		b.WriteString(text)
+	}
+
+	return nil
+}
+
+// expandValue expands the value of the variable, false means undefined (nil, empty list or map)
+func expandValue(op templateOperator, name string, value interface{}, explode bool, prefix int) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case []string:
+		if len(v) == 0 {
+			return "", false
+		}
+
+		items := make([]string, len(v))
+		for i, item := range v {
+			if explode && op.named {
+				items[i] = op.pair(name, item)
+			} else {
+				items[i] = op.encode(item)
+			}
+		}
+
+		if explode {
+			return strings.Join(items, op.sep), true
+		}
+
+		return op.prefix(name) + strings.Join(items, ","), true
+	case map[string]string:
+		if len(v) == 0 {
+			return "", false
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		items := make([]string, len(keys))
+		for i, key := range keys {
+			if explode {
+				items[i] = op.pair(key, v[key])
+			} else {
+				items[i] = op.encode(key) + "," + op.encode(v[key])
+			}
+		}
+
+		if explode {
+			return strings.Join(items, op.sep), true
+		}
+
+		return op.prefix(name) + strings.Join(items, ","), true
+	}
+
+	text := formatTemplateValue(value)
+	if prefix > 0 && utf8.RuneCountInString(text) > prefix {
+		text = string([]rune(text)[:prefix])
+	}
+
+	if op.named {
+		return op.pair(name, text), true
+	}
+
+	return op.encode(text), true
+}
+
+// prefix returns the name of the unexploded list or map for the named operators, like ?list=
+func (op templateOperator) prefix(name string) string {
+	if !op.named {
+		return ""
+	}
+
+	return op.encode(name) + "="
+}
+
+// pair returns name=value, the empty value of the named operators is name + ifemp
+func (op templateOperator) pair(name, value string) string {
+	if !op.named {
+		return op.encode(name) + "=" + op.encode(value)
+	}
+
+	if value == "" {
+		return op.encode(name) + op.ifemp
+	}
+
+	return op.encode(name) + "=" + op.encode(value)
+}
+
+// encode percent-encodes the value, the reserved characters are kept for + and #
+func (op templateOperator) encode(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case isUnreserved(c):
+			b.WriteByte(c)
+		case op.reserved && strings.IndexByte(":/?#[]@!$&'()*+,;=", c) != -1:
+			b.WriteByte(c)
+		case op.reserved && c == '%' && i+2 < len(value) && isHex(value[i+1]) && isHex(value[i+2]):
+			// the pct-encoded triplet is kept
+			b.WriteByte(c)
+		default:
+			b.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+
+	return b.String()
+}
+
+func parseVarSpec(spec string) (name string, explode bool, prefix int, err error) {
+	name = spec
+	if strings.HasSuffix(name, "*") {
+		explode = true
+		name = name[:len(name)-1]
+	} else if index := strings.IndexByte(name, ':'); index != -1 {
+		if prefix, err = strconv.Atoi(name[index+1:]); err != nil || prefix <= 0 || prefix >= 10000 {
+			return "", false, 0, fmt.Errorf("invalid uri template, invalid prefix: %s", spec)
+		}
+		name = name[:index]
+	}
+
+	if name == "" {
+		return "", false, 0, fmt.Errorf("invalid uri template, empty variable: %s", spec)
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; !isAlphaNum(c) && c != '_' && c != '.' && c != '%' {
+			return "", false, 0, fmt.Errorf("invalid uri template, invalid variable: %s", spec)
+		}
+	}
+
+	return name, explode, prefix, nil
+}
+
+func formatTemplateValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case interface{ String() string }:
+		return v.String()
+	}
+
+	if text, ok := formatMultipartValue(value); ok {
+		return text
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// templatePathStart returns the start of the path, after the scheme and host
+func templatePathStart(template string) int {
+	index := strings.Index(template, "://")
+	if index == -1 || strings.ContainsAny(template[:index], "{/?#") {
+		return 0
+	}
+
+	authority := index + 3
+	if end := strings.IndexAny(template[authority:], "/?#"); end != -1 {
+		return authority + end
+	}
+
+	return len(template)
+}
+
+// colonParamName returns the name of :name, like /users/:id
+func colonParamName(s string) string {
+	if s == "" || !(isAlpha(s[0]) || s[0] == '_') {
+		return ""
+	}
+
+	end := 1
+	for end < len(s) && (isAlphaNum(s[end]) || s[end] == '_') {
+		end++
+	}
+
+	return s[:end]
+}
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isAlphaNum(c byte) bool {
+	return isAlpha(c) || ('0' <= c && c <= '9')
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func isUnreserved(c byte) bool {
+	return isAlphaNum(c) || c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,160 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-zoox/testify"
+)
+
+func TestExpandURITemplate(t *testing.T) {
+	// RFC 6570 Section 3.2
+	values := map[string]interface{}{
+		"count":      []string{"one", "two", "three"},
+		"dom":        []string{"example", "com"},
+		"dub":        "me/too",
+		"hello":      "Hello World!",
+		"half":       "50%",
+		"var":        "value",
+		"who":        "fred",
+		"base":       "http://example.com/home/",
+		"path":       "/foo/bar",
+		"list":       []string{"red", "green", "blue"},
+		"keys":       map[string]string{"semi": ";", "dot": ".", "comma": ","},
+		"v":          "6",
+		"x":          "1024",
+		"y":          "768",
+		"empty":      "",
+		"empty_keys": map[string]string{},
+		"undef":      nil,
+	}
+
+	cases := map[string]string{
+		"{var}":                      "value",
+		"{hello}":                    "Hello%20World%21",
+		"{half}":                     "50%25",
+		"O{empty}X":                  "OX",
+		"O{undef}X":                  "OX",
+		"{x,y}":                      "1024,768",
+		"{x,hello,y}":                "1024,Hello%20World%21,768",
+		"?{x,empty}":                 "?1024,",
+		"?{x,undef}":                 "?1024",
+		"{var:3}":                    "val",
+		"{var:30}":                   "value",
+		"{list}":                     "red,green,blue",
+		"{list*}":                    "red,green,blue",
+		"{keys}":                     "comma,%2C,dot,.,semi,%3B",
+		"{keys*}":                    "comma=%2C,dot=.,semi=%3B",
+		"{+var}":                     "value",
+		"{+hello}":                   "Hello%20World!",
+		"{+half}":                    "50%25",
+		"{base}index":                "http%3A%2F%2Fexample.com%2Fhome%2Findex",
+		"{+base}index":               "http://example.com/home/index",
+		"{+path}/here":               "/foo/bar/here",
+		"here?ref={+path}":           "here?ref=/foo/bar",
+		"{+path:6}/here":             "/foo/b/here",
+		"{+list*}":                   "red,green,blue",
+		"{+keys*}":                   "comma=,,dot=.,semi=;",
+		"{#var}":                     "#value",
+		"{#hello}":                   "#Hello%20World!",
+		"{#path:6}/here":             "#/foo/b/here",
+		"{#keys}":                    "#comma,,,dot,.,semi,;",
+		"X{.var}":                    "X.value",
+		"X{.x,y}":                    "X.1024.768",
+		"X{.list*}":                  "X.red.green.blue",
+		"X{.empty_keys}":             "X",
+		"{/who}":                     "/fred",
+		"{/who,who}":                 "/fred/fred",
+		"{/half,who}":                "/50%25/fred",
+		"{/who,dub}":                 "/fred/me%2Ftoo",
+		"{/var,x}/here":              "/value/1024/here",
+		"{/var:1,var}":               "/v/value",
+		"{/list}":                    "/red,green,blue",
+		"{/list*}":                   "/red/green/blue",
+		"{/list*,path:4}":            "/red/green/blue/%2Ffoo",
+		"{/keys*}":                   "/comma=%2C/dot=./semi=%3B",
+		"{;who}":                     ";who=fred",
+		"{;v,empty,who}":             ";v=6;empty;who=fred",
+		"{;x,y,undef}":               ";x=1024;y=768",
+		"{;hello:5}":                 ";hello=Hello",
+		"{;list}":                    ";list=red,green,blue",
+		"{;list*}":                   ";list=red;list=green;list=blue",
+		"{;keys*}":                   ";comma=%2C;dot=.;semi=%3B",
+		"{?who}":                     "?who=fred",
+		"{?x,y,empty}":               "?x=1024&y=768&empty=",
+		"{?var:3}":                   "?var=val",
+		"{?list}":                    "?list=red,green,blue",
+		"{?list*}":                   "?list=red&list=green&list=blue",
+		"{?keys}":                    "?keys=comma,%2C,dot,.,semi,%3B",
+		"{?keys*}":                   "?comma=%2C&dot=.&semi=%3B",
+		"?fixed=yes{&x}":             "?fixed=yes&x=1024",
+		"{&var:3}":                   "&var=val",
+		"{&list*}":                   "&list=red&list=green&list=blue",
+		"find{?dom*}":                "find?dom=example&dom=com",
+		"/users/:who/:dub":           "/users/fred/me%2Ftoo",
+		"/users/:whom/:v":            "/users/:whom/6",
+		"/v1/projects:batch":         "/v1/projects:batch",
+		"http://localhost:8080/:v":   "http://localhost:8080/6",
+		"http://user:x@localhost/:x": "http://user:x@localhost/1024",
+		// the unknown and invalid expressions are literal
+		"/items/{id}":       "/items/{id}",
+		`/search?q={"a":1}`: `/search?q={"a":1}`,
+		"/items/{id":        "/items/{id",
+		"{?who,unknown}":    "?who=fred",
+	}
+
+	for template, expected := range cases {
+		expanded, err := ExpandURITemplate(template, values, false)
+		if err != nil {
+			t.Fatal(template, err)
+		}
+
+		testify.Equal(t, expected, expanded, template)
+	}
+
+	_, err := ExpandURITemplate("/users/{id}", values, true)
+	testify.Assert(t, errors.Is(err, ErrUnresolvedParam), "expected ErrUnresolvedParam")
+
+	_, err = ExpandURITemplate("/users/:id", values, true)
+	testify.Assert(t, errors.Is(err, ErrUnresolvedParam), "expected ErrUnresolvedParam of :id")
+
+	expanded, err := ExpandURITemplate("http://localhost:8080/v1/projects:batchGet/:who", values, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "http://localhost:8080/v1/projects:batchGet/fred", expanded)
+
+	_, err = ExpandURITemplate("/users/{id", values, true)
+	testify.Assert(t, err != nil, "expected unclosed expression")
+}
+
+func TestURITemplateParams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.EscapedPath() + "?" + r.URL.RawQuery))
+	}))
+	defer server.Close()
+
+	response, err := Create(server.URL).
+		SetParam("id", "a b/c").
+		SetParam("identity", "me").
+		SetParamValue("segments", []string{"x", "y"}).
+		SetParamValue("q", "go zoox").
+		Get("/users/:id/:identity{/segments*}{?q,page}").
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, "/users/a%20b%2Fc/me/x/y?q=go+zoox", response.String())
+
+	_, err = Create(server.URL).SetStrictParams(true).Get("/users/{id}").Execute()
+	testify.Assert(t, errors.Is(err, ErrUnresolvedParam), "expected ErrUnresolvedParam")
+
+	// the url without params is kept as it is
+	cfg, err := New().SetURL(`http://example.com/items/{id}?q={"a":1}`).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testify.Equal(t, `http://example.com/items/{id}?q={"a":1}`, cfg.URL)
+}